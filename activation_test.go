@@ -0,0 +1,138 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fetch returns the body served at url, failing the test on any error.
+func fetch(t *testing.T, url string) string {
+	t.Helper()
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestServeListeners(t *testing.T) {
+	var listeners []net.Listener
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "injected")
+	})}
+
+	errs := make(chan error, 1)
+	captureOutput(t, func() {
+		go func() { errs <- serveListeners(srv, listeners) }()
+		for _, l := range listeners {
+			if body := fetch(t, "http://"+l.Addr().String()+"/"); body != "injected" {
+				t.Errorf("%s served %q", l.Addr(), body)
+			}
+		}
+		srv.Close()
+	})
+	if err := <-errs; err != http.ErrServerClosed {
+		t.Errorf("got %v, expected %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestActivatedListeners(t *testing.T) {
+	if os.Getenv("TEST_SOCKET_ACTIVATION") == "1" {
+		// systemd sets LISTEN_PID to the pid it starts
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		listeners, err := activatedListeners()
+		if err != nil || len(listeners) != 1 {
+			t.Fatalf("got %d listeners, err=%v", len(listeners), err)
+		}
+		if os.Getenv("LISTEN_FDS") != "" {
+			t.Fatal("LISTEN_FDS is still set")
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "activated")
+		})}
+		serveListeners(srv, listeners)
+		return
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivatedListeners$")
+	cmd.Env = append(os.Environ(), "TEST_SOCKET_ACTIVATION=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=http")
+	cmd.ExtraFiles = []*os.File{f} // the first is fd 3, as with systemd
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	// only the child accepts from here on
+	f.Close()
+	addr := l.Addr().String()
+	l.Close()
+
+	if body := fetch(t, "http://"+addr+"/"); body != "activated" {
+		t.Errorf("got %q from the socket activated server", body)
+	}
+}
+
+func TestNotSocketActivated(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pid  string
+		fds  string
+	}{
+		{name: "unset"},
+		{name: "another process", pid: strconv.Itoa(os.Getpid() + 1), fds: "1"},
+		{name: "no sockets", pid: strconv.Itoa(os.Getpid()), fds: "0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tc.pid)
+			t.Setenv("LISTEN_FDS", tc.fds)
+			listeners, err := activatedListeners()
+			if err != nil || listeners != nil {
+				t.Errorf("got %d listeners, err=%v, expected to bind -address", len(listeners), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// liveConfig holds the filters adjusted through /admin/config
+var liveConfig = &runtimeConfig{changed: make(chan struct{}, 1)}
+
+// runtimeFilter is what /admin/config accepts and reports. Unset fields
+// fall back to the flags.
+type runtimeFilter struct {
+	// Selector over the Ingress labels, e.g. "team=a"
+	Selector string `json:"selector"`
+
+	// IncludeHosts and ExcludeHosts are patterns matched against the host
+	// of each entry, e.g. "*.example.com". Entries must match an include,
+	// when there are any, and no exclude.
+	IncludeHosts []string `json:"includeHosts"`
+	ExcludeHosts []string `json:"excludeHosts"`
+
+	// SortBy replaces -sort-by
+	SortBy string `json:"sortBy"`
+
+	selector labels.Selector
+}
+
+func (f *runtimeFilter) compile() error {
+	selector, err := labels.Parse(f.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector %q: %v", f.Selector, err)
+	}
+	f.selector = selector
+	for _, pattern := range append(append([]string{}, f.IncludeHosts...), f.ExcludeHosts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %q: %v", pattern, err)
+		}
+	}
+	switch f.SortBy {
+	case "", sortByName, sortByNamespaceCount:
+	default:
+		return fmt.Errorf("unknown sortBy %q", f.SortBy)
+	}
+	return nil
+}
+
+// matches reports if ing passes the filter. Static links don't have labels
+// so the selector only applies to Ingresses.
+func (f *runtimeFilter) matches(ing ingress) bool {
+	if ing.Source == sourceIngress && !f.selector.Matches(labels.Set(ing.labels)) {
+		return false
+	}
+	host := ing.FQDN
+	if u, err := url.Parse(ing.FQDN); err == nil {
+		host = u.Hostname()
+	}
+	if len(f.IncludeHosts) > 0 && !matchAnyHost(f.IncludeHosts, host) {
+		return false
+	}
+	return !matchAnyHost(f.ExcludeHosts, host)
+}
+
+// matchAnyHost reports if host matches any of patterns, ignoring case as
+// hosts are kept as written with -preserve-host-case.
+func matchAnyHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeConfig is the filter in effect, starting from the flags. Nothing is
+// persisted, a restart reverts to the flags.
+type runtimeConfig struct {
+	filter *runtimeFilter
+	mu     sync.RWMutex
+
+	// changed is signalled when the filter is replaced, so the index is
+	// rebuilt with it
+	changed chan struct{}
+}
+
+func (c *runtimeConfig) get() runtimeFilter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.filter == nil {
+		return runtimeFilter{}
+	}
+	return *c.filter
+}
+
+func (c *runtimeConfig) set(f *runtimeFilter) {
+	c.mu.Lock()
+	c.filter = f
+	c.mu.Unlock()
+
+	select {
+	case c.changed <- struct{}{}:
+	default: // a rebuild is already pending
+	}
+}
+
+// apply returns the ings the filter shows.
+func (c *runtimeConfig) apply(ings []ingress) []ingress {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.filter == nil {
+		return ings
+	}
+	out := make([]ingress, 0, len(ings))
+	for i := range ings {
+		if c.filter.matches(ings[i]) {
+			out = append(out, ings[i])
+		}
+	}
+	return out
+}
+
+// sortBy returns the order of the namespace groups, -sort-by unless it's been
+// replaced.
+func (c *runtimeConfig) sortBy() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.filter == nil || c.filter.SortBy == "" {
+		return *flagSortBy
+	}
+	return c.filter.SortBy
+}
+
+// rebuildOnChange sends a fresh snapshot of accum each time the runtime
+// config changes. There's no relist from the API server: the filter is only
+// applied when a snapshot is taken, so the accumulator already holds every
+// entry the informers delivered, filtered or not, and a relist would fetch
+// the same objects again.
+func rebuildOnChange(c *runtimeConfig, accum *ingresses, respChan chan []ingress) {
+	for range c.changed {
+		current := accum.current()
+		sendSnapshot(respChan, current)
+		fmt.Printf("runtime config changed, watching %d Ingress objects\n", len(current))
+	}
+}
+
+// serveConfig reports the runtime filter as JSON, and replaces it with a POST
+// of the same JSON. Requests must be authorized with token.
+func serveConfig(c *runtimeConfig, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-ingress-index"`)
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var f runtimeFilter
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&f); err != nil {
+				http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := f.compile(); err != nil {
+				http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+				return
+			}
+			c.set(&f)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.get())
+	}
+}
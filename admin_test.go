@@ -0,0 +1,134 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestAdminConfig(t *testing.T) {
+	setFlag(t, flagAdmin, true)
+	setFlag(t, flagAdminToken, "hunter2")
+	setFlag(t, flagPreserveHostCase, true)
+	setFlag(t, &liveConfig, &runtimeConfig{changed: make(chan struct{}, 1)})
+
+	accum := &ingresses{}
+	for _, tc := range []struct {
+		name, host, team string
+	}{
+		{"grafana", "grafana.example.com", "a"},
+		{"kibana", "kibana.example.com", "b"},
+		{"vault", "Vault.Internal.Example.com", "a"},
+	} {
+		ing := testIngress("apps", tc.name, tc.host)
+		ing.Labels = map[string]string{"team": tc.team}
+		accum.upsert(testEntries(t, ing))
+	}
+	respChan := make(chan []ingress, 10)
+	go rebuildOnChange(liveConfig, accum, respChan)
+	t.Cleanup(func() { close(liveConfig.changed) })
+
+	_, srv := newTestServer(t)
+	request := func(method, token, body string) (int, string) {
+		r := httptest.NewRequest(method, "/admin/config", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		return rec.Code, rec.Body.String()
+	}
+	names := func(ings []ingress) []string {
+		out := []string{}
+		for _, ing := range ings {
+			out = append(out, ing.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	valid := `{"selector": "team=a", "excludeHosts": ["*.internal.example.com"]}`
+	for _, tc := range []struct {
+		name, method, token, body string
+		code                      int
+	}{
+		{name: "no token", method: "GET", code: http.StatusUnauthorized},
+		{name: "wrong token", method: "POST", token: "wrong", body: valid, code: http.StatusUnauthorized},
+		{name: "bad json", method: "POST", token: "hunter2", body: `{"selector":`, code: http.StatusBadRequest},
+		{name: "unknown field", method: "POST", token: "hunter2", body: `{"namespace": "apps"}`, code: http.StatusBadRequest},
+		{name: "bad selector", method: "POST", token: "hunter2", body: `{"selector": "team in (a"}`, code: http.StatusBadRequest},
+		{name: "bad pattern", method: "POST", token: "hunter2", body: `{"includeHosts": ["["]}`, code: http.StatusBadRequest},
+		{name: "bad sort", method: "POST", token: "hunter2", body: `{"sortBy": "size"}`, code: http.StatusBadRequest},
+		{name: "method", method: "PUT", token: "hunter2", body: valid, code: http.StatusMethodNotAllowed},
+	} {
+		if code, _ := request(tc.method, tc.token, tc.body); code != tc.code {
+			t.Errorf("%s: got %d, expected %d", tc.name, code, tc.code)
+		}
+	}
+	if f := liveConfig.get(); f.Selector != "" || len(f.ExcludeHosts) > 0 {
+		t.Fatalf("a rejected request changed the filter to %+v", f)
+	}
+	if got := names(liveConfig.apply(accum.current())); !reflect.DeepEqual(got, []string{"grafana", "kibana", "vault"}) {
+		t.Errorf("before a change got %v", got)
+	}
+
+	code, body := request("POST", "hunter2", valid)
+	if code != http.StatusOK {
+		t.Fatalf("got %d %s", code, body)
+	}
+	var echoed runtimeFilter
+	if err := json.Unmarshal([]byte(body), &echoed); err != nil || echoed.Selector != "team=a" {
+		t.Errorf("got %s, err=%v", body, err)
+	}
+
+	// the cased host is excluded by the lowercase pattern, kibana by the
+	// selector, and without relisting anything
+	var snapshot []ingress
+	captureOutput(t, func() {
+		snapshot = waitForSnapshot(t, respChan, func([]ingress) bool { return true })
+	})
+	if got := names(snapshot); !reflect.DeepEqual(got, []string{"grafana"}) {
+		t.Errorf("after the change got %v, expected [grafana]", got)
+	}
+
+	if code, body := request("GET", "hunter2", ""); code != http.StatusOK || !strings.Contains(body, `"selector":"team=a"`) {
+		t.Errorf("GET got %d %s", code, body)
+	}
+}
+
+func TestMatchAnyHost(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		host     string
+		match    bool
+	}{
+		{[]string{"*.example.com"}, "grafana.example.com", true},
+		{[]string{"*.example.com"}, "Grafana.Example.COM", true},
+		{[]string{"*.EXAMPLE.com"}, "grafana.example.com", true},
+		{[]string{"*.example.com"}, "example.com", false},
+		{[]string{"admin.example.com", "*.internal.example.com"}, "Vault.Internal.example.com", true},
+		{nil, "grafana.example.com", false},
+	} {
+		if got := matchAnyHost(tc.patterns, tc.host); got != tc.match {
+			t.Errorf("%v %q: got %v, expected %v", tc.patterns, tc.host, got, tc.match)
+		}
+	}
+}
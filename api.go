@@ -0,0 +1,138 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// serveIngresses responds with the current Ingresses as a JSON array, or as
+// CSV with ?format=csv. Entries are always in the order of sortIngresses, by
+// namespace, name and FQDN and then by id, whatever order they were seen in,
+// and each id stays the same while the entry exists, so consecutive responses
+// can be diffed.
+func serveIngresses(sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ings, err := filterRequest(sites, r, current())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" {
+			writeCSV(w, ings)
+			return
+		}
+		if ings == nil {
+			ings = []ingress{} // encode as [] rather than null
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ings)
+	}
+}
+
+// namespaceCount is the number of entries listed from a watched namespace.
+type namespaceCount struct {
+	Namespace string `json:"namespace"`
+	Ingresses int    `json:"ingresses"`
+}
+
+// serveNamespaces responds with every watched namespace and how many of the
+// current Ingresses are in it, including namespaces with none.
+func serveNamespaces(s *informerStatus, sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ings, err := filterRequest(sites, r, current())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+		counts := make(map[string]int)
+		for i := range ings {
+			counts[ings[i].Namespace]++
+		}
+		out := []namespaceCount{}
+		for _, ns := range s.watched() {
+			out = append(out, namespaceCount{Namespace: ns, Ingresses: counts[ns]})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// serveLive responds like /api/ingresses, but builds the entries from the
+// informers' stores when it's requested instead of the accumulated snapshot.
+// Comparing the two shows up an accumulator which has drifted.
+func serveLive(s *informerStatus, sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ings, err := filterRequest(sites, r, liveEntries(s, current()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if ings == nil {
+			ings = []ingress{} // encode as [] rather than null
+		}
+		sortIngresses(ings)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ings)
+	}
+}
+
+// liveEntries builds the entries of every Ingress in the informers' stores
+// without logging, and lists them the way a snapshot of the index would: with
+// the runtime filter and collision policy applied. An entry with a TTL is
+// taken as last seen when the index, current, last saw it, so one the index
+// no longer has is treated as expired.
+func liveEntries(s *informerStatus, current []ingress) []ingress {
+	live := &ingresses{}
+	for _, obj := range s.objects() {
+		ing, ok := obj.(*k8sNetworking.Ingress)
+		if !ok {
+			continue
+		}
+		entries, err := buildEntries(ing, discardf)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			entry.lastSeen = now()
+			if entry.TTL > 0 {
+				seen, ok := lastSeen(current, entry)
+				if !ok {
+					continue
+				}
+				entry.lastSeen = seen
+			}
+			live.active = append(live.active, entry)
+		}
+	}
+	_, ings := live.expire(now())
+	return ings
+}
+
+// lastSeen returns when the entry in ings from the same source as ing was
+// last seen.
+func lastSeen(ings []ingress, ing ingress) (time.Time, bool) {
+	for k := range ings {
+		if sameSource(ings[k], ing) {
+			return ings[k].lastSeen, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,303 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestServeIngresses(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ings []ingress
+	}{
+		{name: "empty"},
+		{name: "entries", ings: []ingress{{Namespace: "apps", Name: "grafana"}, {Namespace: "ops", Name: "kibana"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			serveIngresses(nil, func() []ingress { return tc.ings })(rec, httptest.NewRequest("GET", "/api/ingresses", nil))
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got Content-Type %s", ct)
+			}
+			var got []ingress
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				t.Fatalf("got %s, expected an array", rec.Body.String())
+			}
+			if len(got) != len(tc.ings) {
+				t.Errorf("got %d entries, expected %d", len(got), len(tc.ings))
+			}
+		})
+	}
+}
+
+func TestServeNamespaces(t *testing.T) {
+	s := &informerStatus{}
+	for _, ns := range []string{"ops", "apps"} {
+		hasSynced, store, stop := testInformer(func() bool { return true })
+		s.add(ns, hasSynced, store, stop)
+	}
+	ings := []ingress{{Namespace: "apps", Name: "grafana"}, {Namespace: "apps", Name: "kibana"}}
+
+	rec := httptest.NewRecorder()
+	serveNamespaces(s, nil, func() []ingress { return ings })(rec, httptest.NewRequest("GET", "/api/namespaces", nil))
+
+	var got []namespaceCount
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []namespaceCount{{Namespace: "apps", Ingresses: 2}, {Namespace: "ops", Ingresses: 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+}
+
+func TestServeLive(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("apps", "kibana", "kibana.example.com"),
+		testIngress("apps", "pending"), // in the store, but not listed
+	)
+	captureOutput(t, func() {
+		respChan := startWatching(t, client, "apps")
+		waitForSnapshot(t, respChan, func(ings []ingress) bool { return len(ings) == 2 })
+
+		if _, err := client.NetworkingV1().Ingresses("apps").Create(ctx, testIngress("apps", "loki", "loki.example.com"), k8sMeta.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.NetworkingV1().Ingresses("apps").Delete(ctx, "kibana", k8sMeta.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForSnapshot(t, respChan, func(ings []ingress) bool {
+			return len(ings) == 2 && ings[0].Name != "kibana" && ings[1].Name != "kibana"
+		})
+	})
+
+	// the Ingresses in the store which qualify for the index
+	var stored []string
+	for _, obj := range informers.objects() {
+		ing := obj.(*k8sNetworking.Ingress)
+		if len(ing.Spec.Rules) > 0 {
+			stored = append(stored, ing.Namespace+"/"+ing.Name)
+		}
+	}
+	sort.Strings(stored)
+
+	_, body := get(t, serveLive(informers, nil, func() []ingress { return nil }), "/api/live")
+	var live []ingress
+	if err := json.Unmarshal([]byte(body), &live); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ing := range live {
+		got = append(got, ing.key())
+	}
+	if !reflect.DeepEqual(got, stored) {
+		t.Errorf("/api/live has %v, the store %v", got, stored)
+	}
+	if want := []string{"apps/grafana", "apps/loki"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("/api/live has %v, expected %v", got, want)
+	}
+}
+
+func TestLiveEntries(t *testing.T) {
+	clock := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	setFlag(t, &now, func() time.Time { return clock })
+	setFlag(t, flagCollisionPolicy, collisionLastWins)
+	setFlag(t, flagMaxAnnotationLength, 10)
+	filter := &runtimeFilter{Selector: "team!=b"}
+	if err := filter.compile(); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, &liveConfig, &runtimeConfig{filter: filter, changed: make(chan struct{}, 1)})
+
+	grafana := testIngress("apps", "grafana", "grafana.example.com")
+	grafana.Annotations = map[string]string{annotationDescription: "dashboards and alerts"} // truncated with a warning
+	kibana := testIngress("apps", "kibana", "kibana.example.com")
+	kibana.Labels = map[string]string{"team": "b"} // filtered out
+	older := testIngress("apps", "web-old", "web.example.com")
+	newer := testIngress("apps", "web-new", "web.example.com") // wins the collision
+	newer.CreationTimestamp = k8sMeta.NewTime(older.CreationTimestamp.Add(time.Hour))
+	cached := testIngress("apps", "cache", "cache.example.com")
+	cached.Annotations = map[string]string{annotationTTL: "1m"}
+
+	accum := &ingresses{}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, ing := range []*k8sNetworking.Ingress{grafana, kibana, older, newer, cached} {
+		captureOutput(t, func() { accum.upsert(testEntries(t, ing)) })
+		store.Add(ing)
+	}
+	s := &informerStatus{}
+	s.add("apps", func() bool { return true }, store, make(chan struct{}))
+
+	names := func(ings []ingress) []string {
+		var out []string
+		for _, ing := range ings {
+			out = append(out, ing.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+	for _, tc := range []struct {
+		name     string
+		after    time.Duration
+		expected []string
+	}{
+		{name: "fresh", expected: []string{"cache", "grafana", "web-new"}},
+		{name: "ttl passed", after: 2 * time.Minute, expected: []string{"grafana", "web-new"}},
+	} {
+		clock = clock.Add(tc.after)
+		_, index := accum.expire(clock)
+
+		var live []ingress
+		if out := captureOutput(t, func() { live = liveEntries(s, index) }); out != "" {
+			t.Errorf("%s: building the live entries logged %q", tc.name, out)
+		}
+		if got := names(live); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got %v live, expected %v", tc.name, got, tc.expected)
+		}
+		if got, indexed := names(live), names(index); !reflect.DeepEqual(got, indexed) {
+			t.Errorf("%s: live %v drifted from the index %v", tc.name, got, indexed)
+		}
+	}
+}
+
+func TestServeIngressesFilter(t *testing.T) {
+	var ings []ingress
+	for _, ing := range []*k8sNetworking.Ingress{
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("apps", "kibana", "kibana.example.com"),
+		testIngress("ops", "Grafana-Agent", "agent.example.com"),
+	} {
+		ings = append(ings, testEntries(t, ing)...)
+	}
+	h := serveIngresses(nil, func() []ingress { return ings })
+
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"apps/grafana", "apps/kibana", "ops/Grafana-Agent"}},
+		{"?namespace=apps", []string{"apps/grafana", "apps/kibana"}},
+		{"?namespace=ops", []string{"ops/Grafana-Agent"}},
+		{"?namespace=none", []string{}},
+		{"?name=grafana", []string{"apps/grafana", "ops/Grafana-Agent"}},
+		{"?name=AGENT", []string{"ops/Grafana-Agent"}},
+		{"?namespace=apps&name=grafana", []string{"apps/grafana"}},
+		{"?namespace=apps&name=agent", []string{}},
+	}
+	for _, tc := range cases {
+		resp, body := get(t, h, "/api/ingresses"+tc.query)
+		if resp.StatusCode != 200 {
+			t.Errorf("%q: got status %d", tc.query, resp.StatusCode)
+			continue
+		}
+		var got []ingress
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		keys := []string{}
+		for _, ing := range got {
+			keys = append(keys, ing.key())
+		}
+		if !reflect.DeepEqual(keys, tc.expected) {
+			t.Errorf("%q: got %v, expected %v", tc.query, keys, tc.expected)
+		}
+		if len(tc.expected) == 0 && strings.TrimSpace(body) != "[]" {
+			t.Errorf("%q: got %s, expected an empty array", tc.query, body)
+		}
+	}
+}
+
+func TestStableOrder(t *testing.T) {
+	watchTestNamespace(t, "apps")
+	watchTestNamespace(t, "ops")
+	objects := []*k8sNetworking.Ingress{
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("apps", "Kibana", "kibana.example.com"),
+		testIngress("apps", "kibana", "kibana.example.com"),            // differs only by case
+		testIngress("apps", "multi", "b.example.com", "a.example.com"), // linked by its first host
+		testIngress("ops", "grafana", "grafana.ops.example.com"),
+		testIngress("ops", "alertmanager", "alertmanager.example.com"),
+	}
+
+	// serve returns the /api/ingresses body after the objects arrive in order
+	serve := func(order []int) string {
+		respChan := make(chan []ingress, len(objects))
+		handler := ingressEventHandler(&ingresses{}, respChan)
+		captureOutput(t, func() {
+			for _, i := range order {
+				handler.AddFunc(objects[i])
+			}
+		})
+		_, srv := newTestServer(t, latestSnapshot(respChan)...)
+		_, body := get(t, srv, "/api/ingresses")
+		return body
+	}
+
+	first := serve([]int{0, 1, 2, 3, 4, 5})
+	var got []ingress
+	if err := json.Unmarshal([]byte(first), &got); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	ids := make(map[string]bool)
+	for _, ing := range got {
+		order = append(order, ing.key()+" "+ing.FQDN)
+		if ing.ID == "" || ids[ing.ID] {
+			t.Errorf("%s has a missing or repeated id %q", ing.key(), ing.ID)
+		}
+		ids[ing.ID] = true
+	}
+	expected := []string{
+		"apps/grafana http://grafana.example.com",
+		"apps/Kibana http://kibana.example.com",
+		"apps/kibana http://kibana.example.com",
+		"apps/multi http://b.example.com",
+		"ops/alertmanager http://alertmanager.example.com",
+		"ops/grafana http://grafana.ops.example.com",
+	}
+	// the two kibanas only differ by case, so their ids decide
+	if got[1].ID > got[2].ID {
+		expected[1], expected[2] = expected[2], expected[1]
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("got order\n%s\nexpected\n%s", strings.Join(order, "\n"), strings.Join(expected, "\n"))
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		shuffled := r.Perm(len(objects))
+		if body := serve(shuffled); body != first {
+			t.Fatalf("arriving in order %v changed the response\n%s\nexpected\n%s", shuffled, body, first)
+		}
+	}
+}
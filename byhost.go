@@ -0,0 +1,167 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// route is one path of an Ingress rule and the Service behind it.
+type route struct {
+	Host    string
+	Path    string
+	Service string
+
+	// URL links to the path, with the scheme the host is linked with
+	URL string
+}
+
+// ingressRoutes lists every path of every rule on ing. Rules without a host
+// use -default-host, or are skipped without it, as are invalid hosts.
+func ingressRoutes(ing *k8sNetworking.Ingress) []route {
+	schemeOf := hostScheme(ing)
+	var out []route
+	for _, rule := range ing.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = *flagDefaultHost
+		}
+		host = normalizeHost(host)
+		if host == "" || rule.HTTP == nil {
+			continue
+		}
+		base := url.URL{Scheme: schemeOf(host), Host: urlHost(host)}
+		if validHost(base.Hostname()) != nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			u := base
+			u.Path = path.Path
+			out = append(out, route{
+				Host:    strings.ToLower(host),
+				Path:    path.Path,
+				Service: backendName(path.Backend),
+				URL:     u.String(),
+			})
+		}
+	}
+	return out
+}
+
+// backendName describes backend as "service:port", or "kind/name" for a
+// resource backend.
+func backendName(backend k8sNetworking.IngressBackend) string {
+	switch {
+	case backend.Service != nil:
+		port := backend.Service.Port.Name
+		if port == "" {
+			port = strconv.Itoa(int(backend.Service.Port.Number))
+		}
+		return backend.Service.Name + ":" + port
+	case backend.Resource != nil:
+		return backend.Resource.Kind + "/" + backend.Resource.Name
+	}
+	return ""
+}
+
+// hostGroup is a host with the paths every Ingress routes on it.
+type hostGroup struct {
+	Host   string
+	Routes []hostRoute
+}
+
+// hostRoute is a path on a host and the Ingress contributing it.
+type hostRoute struct {
+	Namespace string
+	Name      string
+	Path      string
+	Service   string
+	Href      string
+	Rel       string
+	Status    string
+	Disabled  bool
+}
+
+// groupByHost aggregates the routes of ings by host, sorted by host and then
+// path. Entries without routes, such as static links, are grouped by the host
+// of their FQDN.
+func groupByHost(ings []ingress) []hostGroup {
+	var groups []hostGroup
+	index := make(map[string]int)
+	seen := make(map[hostRoute]bool)
+	add := func(host string, r hostRoute) {
+		if seen[r] {
+			return // the same Ingress is listed once per scheme or FQDN
+		}
+		seen[r] = true
+		idx, ok := index[host]
+		if !ok {
+			idx = len(groups)
+			index[host] = idx
+			groups = append(groups, hostGroup{Host: host})
+		}
+		groups[idx].Routes = append(groups[idx].Routes, r)
+	}
+
+	for _, ing := range ings {
+		u, err := url.Parse(ing.FQDN)
+		if err != nil {
+			continue
+		}
+		base := hostRoute{
+			Namespace: ing.Namespace,
+			Name:      ing.Name,
+			Rel:       ing.Rel(),
+			Status:    ing.Status,
+			Disabled:  ing.Disabled,
+		}
+		if len(ing.routes) == 0 {
+			r := base
+			r.Path = u.Path + ing.Path
+			r.Href = ing.Href()
+			add(u.Host, r)
+			continue
+		}
+		for _, rt := range ing.routes {
+			r := base
+			r.Path = rt.Path
+			r.Service = rt.Service
+			r.Href = rt.URL
+			add(rt.Host, r)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Host < groups[j].Host
+	})
+	for _, group := range groups {
+		routes := group.Routes
+		sort.SliceStable(routes, func(i, j int) bool {
+			if routes[i].Path != routes[j].Path {
+				return routes[i].Path < routes[j].Path
+			}
+			if routes[i].Namespace != routes[j].Namespace {
+				return routes[i].Namespace < routes[j].Namespace
+			}
+			return routes[i].Name < routes[j].Name
+		})
+	}
+	return groups
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+func TestGroupByHost(t *testing.T) {
+	gateway := func(namespace, name, host string, paths ...string) *k8sNetworking.Ingress {
+		ing := testIngress(namespace, name, host)
+		v := &k8sNetworking.HTTPIngressRuleValue{}
+		for _, p := range paths {
+			v.Paths = append(v.Paths, k8sNetworking.HTTPIngressPath{
+				Path: p,
+				Backend: k8sNetworking.IngressBackend{
+					Service: &k8sNetworking.IngressServiceBackend{
+						Name: name,
+						Port: k8sNetworking.ServiceBackendPort{Name: "http"},
+					},
+				},
+			})
+		}
+		ing.Spec.Rules[0].HTTP = v
+		return ing
+	}
+
+	var ings []ingress
+	for _, ing := range []*k8sNetworking.Ingress{
+		gateway("shop", "orders", "api.example.com", "/orders", "/carts"),
+		gateway("accounts", "users", "API.example.com", "/users"),
+		gateway("shop", "frontend", "api.example.com", "/"),
+		gateway("apps", "grafana", "grafana.example.com", "/"),
+	} {
+		ings = append(ings, testEntries(t, ing)...)
+	}
+
+	type want struct {
+		path, service, namespace, href string
+	}
+	expected := map[string][]want{
+		"api.example.com": {
+			{"/", "frontend:http", "shop", "http://api.example.com/"},
+			{"/carts", "orders:http", "shop", "http://api.example.com/carts"},
+			{"/orders", "orders:http", "shop", "http://api.example.com/orders"},
+			{"/users", "users:http", "accounts", "http://api.example.com/users"},
+		},
+		"grafana.example.com": {
+			{"/", "grafana:http", "apps", "http://grafana.example.com/"},
+		},
+	}
+
+	groups := groupByHost(ings)
+	if len(groups) != 2 || groups[0].Host != "api.example.com" || groups[1].Host != "grafana.example.com" {
+		t.Fatalf("got groups %+v", groups)
+	}
+	for _, group := range groups {
+		routes := expected[group.Host]
+		if len(group.Routes) != len(routes) {
+			t.Errorf("%s: got %d routes, expected %d", group.Host, len(group.Routes), len(routes))
+			continue
+		}
+		for i, r := range group.Routes {
+			got := want{r.Path, r.Service, r.Namespace, r.Href}
+			if got != routes[i] {
+				t.Errorf("%s: route %d is %+v, expected %+v", group.Host, i, got, routes[i])
+			}
+		}
+	}
+
+	_, srv := newTestServer(t, ings...)
+	_, body := get(t, srv, "/?theme=hosts")
+	if n := strings.Count(body, "<h3>api.example.com</h3>"); n != 1 {
+		t.Errorf("got %d api.example.com headings, expected 1", n)
+	}
+	if !strings.Contains(body, `href="http://api.example.com/users">/users</a> <span class="badge" title="backend">users:http</span>`) {
+		t.Error("the /users route is missing")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// pageCacheControl lets browsers reuse a page briefly, then revalidate it
+// with its ETag. Pages differ by the request's host and theme cookie so
+// they're private.
+const pageCacheControl = "private, max-age=10"
+
+// writePage responds with the rendered page, or 304 Not Modified when the
+// client already has it.
+func writePage(w http.ResponseWriter, r *http.Request, page []byte) {
+	sum := sha256.Sum256(page)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Cache-Control", pageCacheControl)
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Cookie")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// etagMatches reports if the If-None-Match header value lists etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// apiCache sets the -api-cache-control header on the responses of next, so
+// browsers don't show stale Ingresses.
+func apiCache(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *flagAPICacheControl != "" {
+			w.Header().Set("Cache-Control", *flagAPICacheControl)
+		}
+		next(w, r)
+	}
+}
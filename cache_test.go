@@ -0,0 +1,76 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCacheHeaders(t *testing.T) {
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+
+	apis := []string{"/api/ingresses", "/api/live", "/api/summary", "/healthsummary.json", "/api/namespaces"}
+	for _, tc := range []struct {
+		name     string
+		flag     string
+		paths    []string
+		expected string
+	}{
+		{name: "pages", flag: "no-store", paths: []string{"/", "/new", "/?theme=grouped"}, expected: pageCacheControl},
+		{name: "api default", flag: "no-store", paths: apis, expected: "no-store"},
+		{name: "api override", flag: "max-age=5", paths: apis, expected: "max-age=5"},
+		{name: "api none", flag: "", paths: apis, expected: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagAPICacheControl, tc.flag)
+			for _, path := range tc.paths {
+				res, _ := get(t, srv, path)
+				if got := res.Header.Get("Cache-Control"); got != tc.expected {
+					t.Errorf("%s: got Cache-Control %q, expected %q", path, got, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPageETag(t *testing.T) {
+	idx, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+
+	res, _ := get(t, srv, "/")
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("the page has no ETag")
+	}
+
+	request := func(ifNoneMatch string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := request(etag); code != 304 {
+		t.Errorf("revalidating an unchanged page got %d, expected 304", code)
+	}
+	if code := request(`"other", W/` + etag); code != 304 {
+		t.Errorf("revalidating with a list of ETags got %d, expected 304", code)
+	}
+
+	idx.set(testEntries(t, testIngress("apps", "kibana", "kibana.example.com")))
+	if code := request(etag); code != 200 {
+		t.Errorf("revalidating a changed page got %d, expected 200", code)
+	}
+}
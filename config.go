@@ -0,0 +1,52 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"strings"
+)
+
+// redactedFlagWords mark flags whose values are credentials and must not be
+// printed.
+var redactedFlagWords = []string{"password", "secret", "token"}
+
+// printConfig writes the effective value of every flag in fs to w as a JSON
+// object keyed by flag name. Values of credential flags are redacted.
+func printConfig(w io.Writer, fs *flag.FlagSet) error {
+	out := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if value != "" && isSecretFlag(f.Name) {
+			value = "REDACTED"
+		}
+		out[f.Name] = value
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func isSecretFlag(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range redactedFlagWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
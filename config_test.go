@@ -0,0 +1,80 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestPrintConfig(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("namespaces", "", "")
+	fs.String("admin-token", "", "")
+	fs.String("webhook-secret", "", "")
+	fs.Bool("force-tls", false, "")
+	if err := fs.Parse([]string{"-namespaces=apps,ops", "-admin-token=hunter2", "-force-tls"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := printConfig(&buf, fs); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output isn't valid JSON: %v\n%s", err, buf.String())
+	}
+	want := map[string]string{
+		"namespaces":     "apps,ops",
+		"admin-token":    "REDACTED",
+		"webhook-secret": "", // unset credentials are shown as unset
+		"force-tls":      "true",
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("got %s=%q, expected %q", name, got[name], value)
+		}
+	}
+}
+
+func TestPrintConfigExits(t *testing.T) {
+	if os.Getenv("TEST_PRINT_CONFIG") == "1" {
+		// a kubeconfig which doesn't exist fails the run if it's read
+		os.Args = []string{"kube-ingress-index", "-print-config", "-namespaces=apps", "-admin-token=hunter2", "-kubeconfig=/nonexistent"}
+		main()
+		t.Fatal("main returned instead of exiting")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPrintConfigExits$")
+	cmd.Env = append(os.Environ(), "TEST_PRINT_CONFIG=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("exited with %v, expected 0\n%s%s", err, stdout.String(), stderr.String())
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("output isn't valid JSON: %v\n%s", err, stdout.String())
+	}
+	if got["namespaces"] != "apps" || got["admin-token"] != "REDACTED" || got["kubeconfig"] != "/nonexistent" {
+		t.Errorf("got namespaces=%q admin-token=%q kubeconfig=%q", got["namespaces"], got["admin-token"], got["kubeconfig"])
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// conflict is an FQDN linked to, or a slug claimed, by more than one
+// Ingress, which is often a misconfiguration.
+type conflict struct {
+	FQDN      string   `json:"fqdn,omitempty"`
+	Slug      string   `json:"slug,omitempty"`
+	Ingresses []string `json:"ingresses"`
+
+	// Winner is the Ingress which a slug redirects to
+	Winner string `json:"winner,omitempty"`
+}
+
+// markConflicts indexes the Ingress entries of ings by FQDN and sets the
+// Conflicts of each entry sharing its FQDN with another Ingress. Entries of
+// the same Ingress don't conflict, nor do static links.
+func markConflicts(ings []ingress) {
+	byFQDN := make(map[string][]string)
+	for i := range ings {
+		if ings[i].Source != sourceIngress {
+			continue
+		}
+		fqdn, key := ings[i].FQDN, ings[i].key()
+		if !containsString(byFQDN[fqdn], key) {
+			byFQDN[fqdn] = append(byFQDN[fqdn], key)
+		}
+	}
+	for i := range ings {
+		keys := byFQDN[ings[i].FQDN]
+		if ings[i].Source != sourceIngress || len(keys) < 2 {
+			continue
+		}
+		others := make([]string, 0, len(keys)-1)
+		for _, key := range keys {
+			if key != ings[i].key() {
+				others = append(others, key)
+			}
+		}
+		sort.Strings(others)
+		ings[i].Conflicts = others
+	}
+}
+
+// ConflictTitle describes the other Ingresses linking to the entry's FQDN.
+func (ing ingress) ConflictTitle() string {
+	return "Also linked to by " + strings.Join(ing.Conflicts, ", ")
+}
+
+// conflicts lists each FQDN with conflicting entries in ings, sorted by FQDN,
+// followed by each slug claimed by several Ingresses, sorted by slug.
+func conflicts(ings []ingress) []conflict {
+	byFQDN := make(map[string][]string)
+	for i := range ings {
+		if len(ings[i].Conflicts) == 0 {
+			continue
+		}
+		for _, key := range append([]string{ings[i].key()}, ings[i].Conflicts...) {
+			if !containsString(byFQDN[ings[i].FQDN], key) {
+				byFQDN[ings[i].FQDN] = append(byFQDN[ings[i].FQDN], key)
+			}
+		}
+	}
+	out := make([]conflict, 0, len(byFQDN))
+	for fqdn, keys := range byFQDN {
+		sort.Strings(keys)
+		out = append(out, conflict{FQDN: fqdn, Ingresses: keys})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].FQDN < out[j].FQDN
+	})
+
+	_, claims := slugTargets(ings)
+	slugs := make([]string, 0, len(claims))
+	for slug := range claims {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		out = append(out, conflict{Slug: slug, Ingresses: claims[slug], Winner: claims[slug][0]})
+	}
+	return out
+}
+
+// serveConflicts responds with the conflicts of the current Ingresses of
+// sites for the Host of the request as JSON. An FQDN is listed when the site
+// shows any of the Ingresses linking to it, slugs when it shows several
+// claiming it.
+func serveConflicts(sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conflicts(sites.forRequest(r).apply(current())))
+	}
+}
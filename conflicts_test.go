@@ -0,0 +1,68 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSharedHostConflicts(t *testing.T) {
+	watchTestNamespace(t, "apps")
+	watchTestNamespace(t, "ops")
+	respChan := make(chan []ingress, 10)
+	handler := ingressEventHandler(&ingresses{}, respChan)
+	captureOutput(t, func() {
+		handler.AddFunc(testIngress("apps", "grafana", "grafana.example.com"))
+		handler.AddFunc(testIngress("ops", "grafana-canary", "grafana.example.com"))
+		handler.AddFunc(testIngress("apps", "kibana", "kibana.example.com"))
+		// one Ingress listing a host twice doesn't conflict with itself
+		handler.AddFunc(testIngress("apps", "loki", "loki.example.com", "loki.example.com"))
+	})
+	ings := latestSnapshot(respChan)
+
+	expected := map[string][]string{
+		"apps/grafana":       {"ops/grafana-canary"},
+		"ops/grafana-canary": {"apps/grafana"},
+	}
+	for _, ing := range ings {
+		if want := expected[ing.key()]; !reflect.DeepEqual(ing.Conflicts, want) {
+			t.Errorf("%s: got conflicts %v, expected %v", ing.key(), ing.Conflicts, want)
+		}
+	}
+
+	_, body := get(t, serveConflicts(nil, func() []ingress { return ings }), "/debug/conflicts")
+	var got []conflict
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []conflict{{FQDN: "http://grafana.example.com", Ingresses: []string{"apps/grafana", "ops/grafana-canary"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/debug/conflicts got %+v, expected %+v", got, want)
+	}
+
+	_, srv := newTestServer(t, ings...)
+	for _, theme := range []string{"default", "grouped"} {
+		_, body := get(t, srv, "/?theme="+theme)
+		if n := strings.Count(body, `class="badge conflict"`); n != 2 {
+			t.Errorf("%s: got %d conflict badges, expected 2", theme, n)
+		}
+		if !strings.Contains(body, `title="Also linked to by ops/grafana-canary"`) {
+			t.Errorf("%s: the badge doesn't name the other Ingress", theme)
+		}
+	}
+}
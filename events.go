@@ -0,0 +1,148 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// how often a comment is sent to idle event streams so proxies keep
+	// the connection open
+	eventsHeartbeat = 15 * time.Second
+)
+
+// broadcaster fans out snapshots of the current ingresses to subscribers.
+//
+// Each subscriber holds at most one pending snapshot, slow subscribers only
+// ever receive the latest one.
+type broadcaster struct {
+	subs   map[chan []ingress]bool
+	closed bool
+	mu     sync.Mutex
+}
+
+func (b *broadcaster) subscribe() chan []ingress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan []ingress, 1)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	if b.subs == nil {
+		b.subs = make(map[chan []ingress]bool)
+	}
+	b.subs[ch] = true
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan []ingress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs[ch] {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *broadcaster) publish(ings []ingress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case <-ch: // drop the stale snapshot
+		default:
+		}
+		ch <- ings
+	}
+}
+
+// close disconnects all subscribers, used when the server shuts down.
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = nil
+	b.closed = true
+}
+
+// serveEvents streams the current ingresses, those of sites for the Host of
+// the request, as Server-Sent Events, sending a new "ingresses" event with
+// the full JSON list each time they change.
+func serveEvents(b *broadcaster, sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		updates := b.subscribe()
+		defer b.unsubscribe(updates)
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+
+		filter := sites.forRequest(r)
+		send := func(ings []ingress) error {
+			bs, err := json.Marshal(filter.apply(ings))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: ingresses\ndata: %s\n\n", bs); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		if err := send(current()); err != nil {
+			return
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case ings, ok := <-updates:
+				if !ok {
+					return // shutting down
+				}
+				if err := send(ings); err != nil {
+					return
+				}
+
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamRecorder hands each write of an event stream to the test, blocking
+// until it's read like a client which isn't keeping up.
+type streamRecorder struct {
+	header http.Header
+	writes chan string
+}
+
+func (s *streamRecorder) Header() http.Header        { return s.header }
+func (s *streamRecorder) WriteHeader(statusCode int) {}
+func (s *streamRecorder) Flush()                     {}
+
+func (s *streamRecorder) Write(p []byte) (int, error) {
+	s.writes <- string(p)
+	return len(p), nil
+}
+
+// subscribers returns the channels subscribed to b.
+func subscribers(b *broadcaster) []chan []ingress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []chan []ingress
+	for ch := range b.subs {
+		out = append(out, ch)
+	}
+	return out
+}
+
+func TestBroadcasterLatestOnly(t *testing.T) {
+	b := &broadcaster{}
+	ch := b.subscribe()
+	for _, name := range []string{"a", "b", "c"} {
+		b.publish([]ingress{{Name: name}}) // never blocks on a subscriber
+	}
+	if got := <-ch; got[0].Name != "c" {
+		t.Errorf("got %q pending, expected only the latest", got[0].Name)
+	}
+
+	b.unsubscribe(ch)
+	b.unsubscribe(ch) // twice is harmless
+	if _, ok := <-ch; ok {
+		t.Error("the channel is open after unsubscribing")
+	}
+	b.publish(nil)
+
+	b.close()
+	if _, ok := <-b.subscribe(); ok {
+		t.Error("subscribing after close returned an open channel")
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	b := &broadcaster{}
+	current := []ingress{{Namespace: "apps", Name: "grafana"}}
+	h := serveEvents(b, nil, func() []ingress { return current })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &streamRecorder{header: make(http.Header), writes: make(chan string)}
+	done := make(chan struct{})
+	go func() {
+		h(w, httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+		close(done)
+	}()
+	read := func() string {
+		select {
+		case s := <-w.writes:
+			return s
+		case <-time.After(time.Second):
+			t.Fatal("no event was written")
+			return ""
+		}
+	}
+	waitFor := func(what string, ok func() bool) {
+		for deadline := time.Now().Add(time.Second); !ok(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	if got := read(); !strings.HasPrefix(got, "event: ingresses\ndata: ") || !strings.Contains(got, `"name":"grafana"`) {
+		t.Errorf("got %q first, expected the current ingresses", got)
+	}
+	if ct := w.header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+
+	// Once the handler holds a snapshot it's stuck writing to us, those
+	// published meanwhile replace each other.
+	b.publish([]ingress{{Name: "first"}})
+	waitFor("the handler to take the snapshot", func() bool {
+		subs := subscribers(b)
+		return len(subs) == 1 && len(subs[0]) == 0
+	})
+	for _, name := range []string{"second", "third", "latest"} {
+		b.publish([]ingress{{Name: name}})
+	}
+	for _, want := range []string{"first", "latest"} {
+		if got := read(); !strings.Contains(got, `"name":"`+want+`"`) {
+			t.Errorf("got %q, expected %s", got, want)
+		}
+	}
+
+	// the client going away unsubscribes and ends the handler
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the handler didn't return after the request was cancelled")
+	}
+	if subs := subscribers(b); len(subs) != 0 {
+		t.Errorf("%d subscribers left after disconnecting", len(subs))
+	}
+}
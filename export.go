@@ -0,0 +1,88 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"namespace", "name", "fqdn", "class", "tls", "created"}
+
+// serveCSV responds with the current Ingresses, after any filters given in the
+// query, as a CSV attachment.
+func serveCSV(sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ings, err := filterRequest(sites, r, current())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeCSV(w, ings)
+	}
+}
+
+// writeCSV streams ingresses as a CSV attachment, one row per entry.
+func writeCSV(w http.ResponseWriter, ingresses []ingress) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="ingresses.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write(csvHeader)
+	for _, ing := range ingresses {
+		out.Write([]string{
+			ing.Namespace,
+			ing.Name,
+			ing.FQDN,
+			ing.Class,
+			strconv.FormatBool(ing.TLS),
+			ing.Created.UTC().Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		fmt.Printf("error writing CSV export, err=%v\n", err)
+	}
+}
+
+// serveJSONLines streams the current Ingresses, after any filters given in
+// the query, as JSON Lines: one JSON object per line, flushed as it's written.
+func serveJSONLines(sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ings, err := filterRequest(sites, r, current())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jsonl; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="ingresses.jsonl"`)
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w) // Encode ends each object with a newline
+		for i := range ings {
+			if err := enc.Encode(ings[i]); err != nil {
+				fmt.Printf("error writing JSON Lines export, err=%v\n", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// exportIngresses are the entries the export tests serve.
+func exportIngresses(t *testing.T) []ingress {
+	t.Helper()
+	secure := testIngress("apps", "grafana", "grafana.example.com")
+	secure.Spec.TLS = []k8sNetworking.IngressTLS{{Hosts: []string{"grafana.example.com"}}}
+	other := testIngress("ops", "kibana", "kibana.example.com")
+	ings := append(testEntries(t, secure), testEntries(t, other)...)
+	sortIngresses(ings)
+	return ings
+}
+
+func TestServeCSV(t *testing.T) {
+	ings := exportIngresses(t)
+
+	for _, tc := range []struct {
+		query string
+		rows  [][]string
+	}{
+		{
+			query: "",
+			rows: [][]string{
+				csvHeader,
+				{"apps", "grafana", "https://grafana.example.com", "", "true", "2020-01-01T00:00:00Z"},
+				{"ops", "kibana", "http://kibana.example.com", "", "false", "2020-01-01T00:00:00Z"},
+			},
+		},
+		{
+			query: "?namespace=ops",
+			rows: [][]string{
+				csvHeader,
+				{"ops", "kibana", "http://kibana.example.com", "", "false", "2020-01-01T00:00:00Z"},
+			},
+		},
+		{
+			query: "?namespace=none",
+			rows:  [][]string{csvHeader},
+		},
+	} {
+		rec := httptest.NewRecorder()
+		serveCSV(nil, func() []ingress { return ings })(rec, httptest.NewRequest("GET", "/export.csv"+tc.query, nil))
+
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Errorf("%q: got Content-Type %s", tc.query, ct)
+		}
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("%q: parsing CSV: %v", tc.query, err)
+		}
+		if !reflect.DeepEqual(rows, tc.rows) {
+			t.Errorf("%q: got rows %q, expected %q", tc.query, rows, tc.rows)
+		}
+	}
+}
+
+func TestServeJSONLines(t *testing.T) {
+	ings := exportIngresses(t)
+
+	for _, tc := range []struct {
+		query string
+		names []string
+	}{
+		{query: "", names: []string{"grafana", "kibana"}},
+		{query: "?namespace=apps", names: []string{"grafana"}},
+		{query: "?namespace=none"},
+	} {
+		rec := httptest.NewRecorder()
+		serveJSONLines(nil, func() []ingress { return ings })(rec, httptest.NewRequest("GET", "/export.jsonl"+tc.query, nil))
+
+		var names []string
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			var ing ingress
+			if err := json.Unmarshal(scanner.Bytes(), &ing); err != nil {
+				t.Fatalf("%q: line %q doesn't parse on its own: %v", tc.query, scanner.Text(), err)
+			}
+			names = append(names, ing.Name)
+		}
+		if !reflect.DeepEqual(names, tc.names) {
+			t.Errorf("%q: got %v, expected %v", tc.query, names, tc.names)
+		}
+		if !rec.Flushed && len(tc.names) > 0 {
+			t.Errorf("%q: lines weren't flushed as they were written", tc.query)
+		}
+	}
+}
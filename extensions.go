@@ -0,0 +1,142 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	k8sExtensions "k8s.io/api/extensions/v1beta1"
+	k8sNetworking "k8s.io/api/networking/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// API groups an Ingress can be read from
+const (
+	apiGroupNetworking = "networking.k8s.io"
+	apiGroupExtensions = "extensions"
+)
+
+// apiGroupRank orders the API groups, when an Ingress is seen under several
+// the highest ranked wins.
+var apiGroupRank = map[string]int{
+	apiGroupExtensions: 1,
+	apiGroupNetworking: 2,
+}
+
+// ingressAPIGroup returns the API group ing was read from. Informers don't
+// fill in TypeMeta, so anything not converted by fromExtensions is from
+// networking.k8s.io.
+func ingressAPIGroup(ing *k8sNetworking.Ingress) string {
+	if strings.HasPrefix(ing.APIVersion, apiGroupExtensions+"/") {
+		return apiGroupExtensions
+	}
+	return apiGroupNetworking
+}
+
+// fromExtensions converts an extensions/v1beta1 Ingress into its
+// networking.k8s.io/v1 form, keeping the API group it came from in TypeMeta.
+func fromExtensions(in *k8sExtensions.Ingress) *k8sNetworking.Ingress {
+	out := &k8sNetworking.Ingress{
+		TypeMeta: k8sMeta.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: k8sExtensions.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: in.ObjectMeta,
+		Status: k8sNetworking.IngressStatus{
+			LoadBalancer: in.Status.LoadBalancer,
+		},
+	}
+	out.Spec.IngressClassName = in.Spec.IngressClassName
+	if in.Spec.Backend != nil {
+		out.Spec.DefaultBackend = fromExtensionsBackend(*in.Spec.Backend)
+	}
+	for _, tls := range in.Spec.TLS {
+		out.Spec.TLS = append(out.Spec.TLS, k8sNetworking.IngressTLS{
+			Hosts:      tls.Hosts,
+			SecretName: tls.SecretName,
+		})
+	}
+	for _, rule := range in.Spec.Rules {
+		r := k8sNetworking.IngressRule{Host: rule.Host}
+		if rule.HTTP != nil {
+			r.HTTP = &k8sNetworking.HTTPIngressRuleValue{}
+			for _, p := range rule.HTTP.Paths {
+				path := k8sNetworking.HTTPIngressPath{
+					Path:    p.Path,
+					Backend: *fromExtensionsBackend(p.Backend),
+				}
+				if p.PathType != nil {
+					pathType := k8sNetworking.PathType(*p.PathType)
+					path.PathType = &pathType
+				}
+				r.HTTP.Paths = append(r.HTTP.Paths, path)
+			}
+		}
+		out.Spec.Rules = append(out.Spec.Rules, r)
+	}
+	return out
+}
+
+func fromExtensionsBackend(in k8sExtensions.IngressBackend) *k8sNetworking.IngressBackend {
+	if in.Resource != nil {
+		return &k8sNetworking.IngressBackend{Resource: in.Resource}
+	}
+	svc := &k8sNetworking.IngressServiceBackend{Name: in.ServiceName}
+	if in.ServicePort.Type == intstr.String {
+		svc.Port.Name = in.ServicePort.StrVal
+	} else {
+		svc.Port.Number = in.ServicePort.IntVal
+	}
+	return &k8sNetworking.IngressBackend{Service: svc}
+}
+
+// watchExtensionsIngresses feeds the extensions/v1beta1 Ingresses of ns into
+// handler, converted to their networking.k8s.io/v1 form, until stop is closed.
+func watchExtensionsIngresses(kubeClient kubernetes.Interface, ns string, handler cache.ResourceEventHandler, stop chan struct{}) {
+	convert := func(obj interface{}) interface{} {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if ing, ok := obj.(*k8sExtensions.Ingress); ok {
+			return fromExtensions(ing)
+		}
+		return obj
+	}
+	watch := &cache.ListWatch{
+		ListFunc: func(opts k8sMeta.ListOptions) (runtime.Object, error) {
+			return kubeClient.ExtensionsV1beta1().Ingresses(ns).List(ctx, opts)
+		},
+		WatchFunc: func(opts k8sMeta.ListOptions) (watch.Interface, error) {
+			return kubeClient.ExtensionsV1beta1().Ingresses(ns).Watch(ctx, opts)
+		},
+	}
+	_, controller := cache.NewInformer(watch, &k8sExtensions.Ingress{}, *flagResyncInterval, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handler.OnAdd(convert(obj))
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			handler.OnUpdate(convert(old), convert(cur))
+		},
+		DeleteFunc: func(obj interface{}) {
+			handler.OnDelete(convert(obj))
+		},
+	})
+	go controller.Run(stop)
+}
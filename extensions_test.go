@@ -0,0 +1,111 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	k8sExtensions "k8s.io/api/extensions/v1beta1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/cache"
+)
+
+// testExtensionsIngress returns an extensions/v1beta1 Ingress namespace/name
+// routing / on host to the web Service.
+func testExtensionsIngress(namespace, name, host string) *k8sExtensions.Ingress {
+	return &k8sExtensions.Ingress{
+		ObjectMeta: k8sMeta.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: k8sExtensions.IngressSpec{
+			Rules: []k8sExtensions.IngressRule{{
+				Host: host,
+				IngressRuleValue: k8sExtensions.IngressRuleValue{HTTP: &k8sExtensions.HTTPIngressRuleValue{
+					Paths: []k8sExtensions.HTTPIngressPath{{
+						Path:    "/",
+						Backend: k8sExtensions.IngressBackend{ServiceName: "web", ServicePort: intstr.FromString("http")},
+					}},
+				}},
+			}},
+		},
+	}
+}
+
+func TestIngressUnderTwoGroups(t *testing.T) {
+	watchTestNamespace(t, "apps")
+
+	// the extensions copy still has the host from before the migration
+	networking := testIngress("apps", "web", "web.example.com")
+	extensions := fromExtensions(testExtensionsIngress("apps", "web", "old.example.com"))
+	other := fromExtensions(testExtensionsIngress("apps", "legacy", "legacy.example.com"))
+
+	for _, tc := range []struct {
+		name  string
+		event func(h cache.ResourceEventHandlerFuncs)
+		fqdns []string
+	}{
+		{name: "networking first", event: func(h cache.ResourceEventHandlerFuncs) {
+			h.AddFunc(networking)
+			h.AddFunc(extensions)
+		}, fqdns: []string{"http://web.example.com"}},
+		{name: "extensions first", event: func(h cache.ResourceEventHandlerFuncs) {
+			h.AddFunc(extensions)
+			h.AddFunc(networking)
+		}, fqdns: []string{"http://web.example.com"}},
+		{name: "networking deleted", event: func(h cache.ResourceEventHandlerFuncs) {
+			h.AddFunc(networking)
+			h.AddFunc(extensions)
+			h.DeleteFunc(networking)
+		}, fqdns: []string{"http://old.example.com"}},
+		{name: "extensions deleted", event: func(h cache.ResourceEventHandlerFuncs) {
+			h.AddFunc(networking)
+			h.AddFunc(extensions)
+			h.DeleteFunc(extensions)
+		}, fqdns: []string{"http://web.example.com"}},
+		{name: "only under extensions", event: func(h cache.ResourceEventHandlerFuncs) {
+			h.AddFunc(networking)
+			h.AddFunc(other)
+		}, fqdns: []string{"http://legacy.example.com", "http://web.example.com"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			accum := &ingresses{}
+			captureOutput(t, func() { tc.event(ingressEventHandler(accum, make(chan []ingress, 10))) })
+
+			got := accum.current()
+			sortIngresses(got)
+			var fqdns []string
+			for _, ing := range got {
+				fqdns = append(fqdns, ing.FQDN)
+			}
+			if !reflect.DeepEqual(fqdns, tc.fqdns) {
+				t.Errorf("got %v, expected %v", fqdns, tc.fqdns)
+			}
+		})
+	}
+}
+
+func TestFromExtensions(t *testing.T) {
+	ing := fromExtensions(testExtensionsIngress("apps", "web", "web.example.com"))
+	if group := ingressAPIGroup(ing); group != apiGroupExtensions {
+		t.Errorf("got API group %s, expected %s", group, apiGroupExtensions)
+	}
+	backend := ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+	if backend == nil || backend.Name != "web" || backend.Port.Name != "http" {
+		t.Errorf("got backend %+v, expected web:http", backend)
+	}
+	if group := ingressAPIGroup(testIngress("apps", "web", "web.example.com")); group != apiGroupNetworking {
+		t.Errorf("got API group %s for an informer's Ingress, expected %s", group, apiGroupNetworking)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// hostFilter limits which Ingresses are shown on one site.
+type hostFilter struct {
+	// Namespaces to show, every namespace when empty
+	Namespaces []string `json:"namespaces"`
+
+	// Selector over the Ingress labels, e.g. "team=a"
+	Selector string `json:"selector"`
+
+	namespaces map[string]bool
+	selector   labels.Selector
+}
+
+// hostFilters maps the Host a request was made to onto the filter for it.
+type hostFilters struct {
+	Hosts map[string]*hostFilter `json:"hosts"`
+
+	// Default applies to hosts which aren't listed, nil shows everything
+	Default *hostFilter `json:"default"`
+}
+
+// loadHostFilters reads the JSON config file at path, e.g.
+//
+//	{"hosts": {"team-a.index.example.com": {"namespaces": ["team-a"]}}}
+//
+// An empty path returns nil, which doesn't filter.
+func loadHostFilters(path string) (*hostFilters, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out hostFilters
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]*hostFilter, len(out.Hosts))
+	for host, f := range out.Hosts {
+		if f == nil {
+			f = &hostFilter{}
+		}
+		if err := f.compile(); err != nil {
+			return nil, fmt.Errorf("host %s: %v", host, err)
+		}
+		hosts[strings.ToLower(host)] = f
+	}
+	out.Hosts = hosts
+	if out.Default != nil {
+		if err := out.Default.compile(); err != nil {
+			return nil, fmt.Errorf("default: %v", err)
+		}
+	}
+	return &out, nil
+}
+
+func (f *hostFilter) compile() error {
+	f.namespaces = make(map[string]bool)
+	for _, ns := range f.Namespaces {
+		f.namespaces[ns] = true
+	}
+	selector, err := labels.Parse(f.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector %q: %v", f.Selector, err)
+	}
+	f.selector = selector
+	return nil
+}
+
+// forRequest returns the filter for the Host r was made to, nil when
+// everything is shown.
+func (h *hostFilters) forRequest(r *http.Request) *hostFilter {
+	if h == nil {
+		return nil
+	}
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if f, ok := h.Hosts[strings.ToLower(host)]; ok {
+		return f
+	}
+	return h.Default
+}
+
+// apply returns the ings the filter shows. A nil filter shows them all.
+func (f *hostFilter) apply(ings []ingress) []ingress {
+	if f == nil {
+		return ings
+	}
+	var out []ingress
+	for i := range ings {
+		if len(f.namespaces) > 0 && !f.namespaces[ings[i].Namespace] {
+			continue
+		}
+		if !f.selector.Matches(labels.Set(ings[i].labels)) {
+			continue
+		}
+		out = append(out, ings[i])
+	}
+	return out
+}
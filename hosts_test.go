@@ -0,0 +1,112 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// writeHostFilters writes config to a file and points -host-filters at it.
+func writeHostFilters(t *testing.T, config string) {
+	t.Helper()
+	setFlag(t, flagHostFilters, writeTempFile(t, "sites.json", config))
+}
+
+func TestHostFiltersEndpoints(t *testing.T) {
+	writeHostFilters(t, `{"hosts": {"team-a.index.example.com": {"namespaces": ["team-a"]}}}`)
+
+	a := testIngress("team-a", "grafana", "grafana.a.example.com")
+	a.Annotations = map[string]string{annotationSlug: "grafana-a"}
+	b := testIngress("team-b", "grafana", "grafana.b.example.com")
+	b.Annotations = map[string]string{annotationSlug: "grafana-b"}
+	shared := testIngress("team-b", "shared", "grafana.a.example.com") // conflicts with team-a/grafana
+	var ings []ingress
+	for _, ing := range []*k8sNetworking.Ingress{a, b, shared} {
+		ings = append(ings, testEntries(t, ing)...)
+	}
+	accum := &ingresses{}
+	_, srv := newTestServer(t, accum.upsert(ings)...)
+
+	request := func(host, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Host = host
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for _, path := range []string{"/", "/api/ingresses", "/export.csv", "/export.jsonl", "/debug/conflicts"} {
+		body := request("team-a.index.example.com", path).Body.String()
+		if strings.Contains(body, "grafana.b.example.com") {
+			t.Errorf("%s on team-a shows team-b's Ingress: %s", path, body)
+		}
+		body = request("index.example.com", path).Body.String()
+		if !strings.Contains(body, "grafana.b.example.com") && path != "/debug/conflicts" {
+			t.Errorf("%s on an unfiltered host is missing team-b's Ingress", path)
+		}
+	}
+
+	for host, unknown := range map[string]int{"team-a.index.example.com": 1, "index.example.com": 2} {
+		var summary healthSummary
+		json.NewDecoder(request(host, "/healthsummary.json").Body).Decode(&summary)
+		if summary.Unknown != unknown {
+			t.Errorf("/healthsummary.json on %s counts %d unknown, expected %d", host, summary.Unknown, unknown)
+		}
+	}
+
+	if rec := request("team-a.index.example.com", "/go/grafana-a"); rec.Code != http.StatusFound {
+		t.Errorf("team-a's slug on team-a got %d, expected 302", rec.Code)
+	}
+	if rec := request("team-a.index.example.com", "/go/grafana-b"); rec.Code != http.StatusNotFound {
+		t.Errorf("team-b's slug on team-a got %d, expected 404", rec.Code)
+	}
+	if rec := request("index.example.com", "/go/grafana-b"); rec.Code != http.StatusFound {
+		t.Errorf("team-b's slug on an unfiltered host got %d, expected 302", rec.Code)
+	}
+}
+
+func TestHostFiltersEvents(t *testing.T) {
+	writeHostFilters(t, `{"hosts": {"team-a.index.example.com": {"namespaces": ["team-a"]}}}`)
+
+	var ings []ingress
+	ings = append(ings, testEntries(t, testIngress("team-a", "web", "web.a.example.com"))...)
+	ings = append(ings, testEntries(t, testIngress("team-b", "web", "web.b.example.com"))...)
+	_, srv := newTestServer(t, ings...)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/events", nil)
+	req.Host = "team-a.index.example.com"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// the first event is the current Ingresses
+	buf := make([]byte, 4096)
+	n, _ := res.Body.Read(buf)
+	event := string(buf[:n])
+	if !strings.Contains(event, "web.a.example.com") || strings.Contains(event, "web.b.example.com") {
+		t.Errorf("got event %q, expected only team-a's Ingress", event)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerStatus tracks the Ingress informer of each watched namespace.
+type informerStatus struct {
+	namespaces map[string]*namespaceInformer
+	skipped    map[string]string // namespace to reason
+	mu         sync.Mutex
+
+	// started is set once the informers of the namespaces to watch at
+	// startup have been added, however many there are
+	started bool
+}
+
+type namespaceInformer struct {
+	hasSynced func() bool
+	store     cache.Store
+	stop      chan struct{}
+	started   time.Time
+	lastEvent time.Time
+}
+
+// add starts tracking the informer for ns, replacing any previous one.
+func (s *informerStatus) add(ns string, hasSynced func() bool, store cache.Store, stop chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.namespaces == nil {
+		s.namespaces = make(map[string]*namespaceInformer)
+	}
+	s.namespaces[ns] = &namespaceInformer{
+		hasSynced: hasSynced,
+		store:     store,
+		stop:      stop,
+		started:   time.Now(),
+	}
+}
+
+// markStarted records that the namespaces to watch at startup have been
+// added.
+func (s *informerStatus) markStarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = true
+}
+
+// skip records that ns isn't being watched and why.
+func (s *informerStatus) skip(ns, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.skipped == nil {
+		s.skipped = make(map[string]string)
+	}
+	s.skipped[ns] = reason
+}
+
+// replace stops the informer of ns and tracks the one start returns in its
+// place, reporting if it did. It does nothing when ns isn't being watched,
+// so a namespace removed meanwhile isn't brought back, and start is called
+// with the lock held so remove can't close the stop channel twice.
+func (s *informerStatus) replace(ns string, start func() (hasSynced func() bool, store cache.Store, stop chan struct{})) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inf, ok := s.namespaces[ns]
+	if !ok {
+		return false
+	}
+	close(inf.stop)
+	hasSynced, store, stop := start()
+	s.namespaces[ns] = &namespaceInformer{
+		hasSynced: hasSynced,
+		store:     store,
+		stop:      stop,
+		started:   time.Now(),
+	}
+	return true
+}
+
+// objects returns every object in the stores of the running informers.
+func (s *informerStatus) objects() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []interface{}
+	for _, inf := range s.namespaces {
+		if inf.store != nil {
+			out = append(out, inf.store.List()...)
+		}
+	}
+	return out
+}
+
+// watched returns the sorted namespaces whose informer is running.
+func (s *informerStatus) watched() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]string, 0, len(s.namespaces))
+	for ns := range s.namespaces {
+		out = append(out, ns)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// remove stops the informer of ns and forgets about the namespace, reporting
+// if it was being watched.
+func (s *informerStatus) remove(ns string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.skipped, ns)
+	inf, ok := s.namespaces[ns]
+	if ok {
+		close(inf.stop)
+		delete(s.namespaces, ns)
+	}
+	return ok
+}
+
+// stale returns the namespaces whose informer has synced and holds objects,
+// but hasn't delivered an event, resyncs included, within timeout.
+func (s *informerStatus) stale(timeout time.Duration) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []string
+	for ns, inf := range s.namespaces {
+		if !inf.hasSynced() || len(inf.store.ListKeys()) == 0 {
+			continue // nothing to resync, silence is expected
+		}
+		last := inf.lastEvent
+		if last.Before(inf.started) {
+			last = inf.started
+		}
+		if time.Since(last) > timeout {
+			out = append(out, ns)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// seen records an event from the informer of ns, reporting if ns is still
+// being watched.
+func (s *informerStatus) seen(ns string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inf, ok := s.namespaces[ns]
+	if ok {
+		inf.lastEvent = time.Now()
+	}
+	return ok
+}
+
+// ready returns an error describing why we aren't ready to serve an accurate
+// index: no namespaces being watched or some not synced yet.
+func (s *informerStatus) ready() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.namespaces) == 0 {
+		return errors.New("no namespaces are being watched")
+	}
+	return s.unsynced()
+}
+
+// synced returns an error until the namespaces to watch at startup have been
+// added and their informers have synced. Unlike ready, watching none counts
+// as synced, e.g. when -namespace-selector matches no namespace yet.
+func (s *informerStatus) synced() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return errors.New("waiting for the namespaces to watch")
+	}
+	return s.unsynced()
+}
+
+// unsynced returns an error naming the namespaces whose informer hasn't
+// synced, if any. s.mu must be held.
+func (s *informerStatus) unsynced() error {
+	var unsynced []string
+	for ns, inf := range s.namespaces {
+		if !inf.hasSynced() {
+			unsynced = append(unsynced, ns)
+		}
+	}
+	if len(unsynced) > 0 {
+		sort.Strings(unsynced)
+		return fmt.Errorf("waiting for namespaces to sync: %s", strings.Join(unsynced, ", "))
+	}
+	return nil
+}
+
+// serveReady answers 200 once every informer has synced and at least min
+// Ingresses are indexed, 503 otherwise.
+func serveReady(s *informerStatus, current func() []ingress, min int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.ready(); err != nil {
+			http.Error(w, fmt.Sprintf("not ready: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		if n := countIngresses(current()); n < min {
+			http.Error(w, fmt.Sprintf("not ready: found %d Ingresses, expected at least %d", n, min), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// countIngresses returns how many Ingress objects ings were built from,
+// ignoring static links.
+func countIngresses(ings []ingress) int {
+	seen := make(map[string]bool)
+	for i := range ings {
+		if ings[i].Source == sourceIngress {
+			seen[ings[i].key()] = true
+		}
+	}
+	return len(seen)
+}
+
+// namespaceStatus is the state of a single namespace's informer.
+type namespaceStatus struct {
+	Synced        bool       `json:"synced"`
+	LastEventTime *time.Time `json:"lastEventTime,omitempty"`
+	IngressCount  int        `json:"ingressCount"`
+
+	// Skipped explains why the namespace isn't being watched
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// status reports on each watched namespace, counting ings by namespace.
+func (s *informerStatus) status(ings []ingress) map[string]namespaceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]namespaceStatus, len(s.namespaces))
+	for ns, inf := range s.namespaces {
+		st := namespaceStatus{
+			Synced: inf.hasSynced(),
+		}
+		if !inf.lastEvent.IsZero() {
+			t := inf.lastEvent
+			st.LastEventTime = &t
+		}
+		out[ns] = st
+	}
+	for ns, reason := range s.skipped {
+		out[ns] = namespaceStatus{Skipped: reason}
+	}
+	for i := range ings {
+		if st, ok := out[ings[i].Namespace]; ok {
+			st.IngressCount++
+			out[ings[i].Namespace] = st
+		}
+	}
+	return out
+}
+
+// serveNamespaceStatus responds with the status of each watched namespace.
+func serveNamespaceStatus(s *informerStatus, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.status(current()))
+	}
+}
+
+// watchdog restarts informers which have gone quiet for longer than timeout,
+// as a wedged informer otherwise keeps reporting itself as synced. It never
+// returns.
+func watchdog(s *informerStatus, timeout time.Duration, restart func(ns string)) {
+	for {
+		time.Sleep(timeout / 4)
+
+		for _, ns := range s.stale(timeout) {
+			fmt.Printf("WARNING: no Ingress events from namespace %s in %v, restarting its informer\n", ns, timeout)
+			informerRestarts.inc()
+			restart(ns)
+		}
+	}
+}
+
+// syncPollInterval is how often waitForSync checks the informers
+var syncPollInterval = 100 * time.Millisecond
+
+// syncTimeout is sent when the informers don't sync within
+// -wait-for-sync-timeout.
+type syncTimeout struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *syncTimeout) Error() string {
+	return fmt.Sprintf("informers didn't sync within -wait-for-sync-timeout=%v, %v", e.timeout, e.err)
+}
+
+// waitForSync holds back every request to next but the health endpoints
+// with a 503 until s has synced. If that takes longer than timeout a
+// *syncTimeout is sent on doneChan, shutting us down.
+func waitForSync(s *informerStatus, timeout time.Duration, basePath string, doneChan chan error, next http.Handler) http.Handler {
+	synced := make(chan struct{})
+	go func() {
+		deadline := time.Now().Add(timeout)
+		for {
+			err := s.synced()
+			if err == nil {
+				fmt.Println("informers synced, serving the index")
+				close(synced)
+				return
+			}
+			if time.Now().After(deadline) {
+				select {
+				case doneChan <- &syncTimeout{timeout: timeout, err: err}:
+				default: // already shutting down
+				}
+				return
+			}
+			time.Sleep(syncPollInterval)
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-synced:
+		default:
+			switch strings.TrimPrefix(r.URL.Path, basePath) {
+			case "/healthz", "/readyz", "/metrics", "/debug/namespaces":
+			default:
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "503 service unavailable: waiting for informers to sync", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// warmup answers requests with loading instead of next until s is ready, for
+// at most period after it's called. Unlike waitForSync visitors get a page
+// straight away, which refreshes itself until the index is there.
+func warmup(s *informerStatus, period time.Duration, loading, next http.HandlerFunc) http.HandlerFunc {
+	if period <= 0 {
+		return next
+	}
+	until := time.Now().Add(period)
+	var warm int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&warm) == 0 {
+			if s.ready() != nil && time.Now().Before(until) {
+				loading(w, r)
+				return
+			}
+			atomic.StoreInt32(&warm, 1)
+		}
+		next(w, r)
+	}
+}
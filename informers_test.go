@@ -0,0 +1,290 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// testInformer returns what informerStatus tracks of an informer which has
+// synced when synced returns true.
+func testInformer(synced func() bool) (func() bool, cache.Store, chan struct{}) {
+	return synced, cache.NewStore(cache.MetaNamespaceKeyFunc), make(chan struct{})
+}
+
+func TestInformerReplace(t *testing.T) {
+	always := func() bool { return true }
+	s := &informerStatus{}
+
+	hasSynced, store, first := testInformer(always)
+	s.add("apps", hasSynced, store, first)
+
+	var second chan struct{}
+	replaced := s.replace("apps", func() (func() bool, cache.Store, chan struct{}) {
+		hasSynced, store, second = testInformer(always)
+		return hasSynced, store, second
+	})
+	if !replaced {
+		t.Fatal("replacing a watched namespace reported it isn't watched")
+	}
+	select {
+	case <-first:
+	default:
+		t.Error("the replaced informer wasn't stopped")
+	}
+
+	// removing stops the new informer only, closing the old stop again would
+	// panic
+	if !s.remove("apps") {
+		t.Fatal("remove reported apps isn't watched")
+	}
+	select {
+	case <-second:
+	default:
+		t.Error("remove didn't stop the new informer")
+	}
+
+	// a namespace removed before the watchdog restarts it stays removed
+	replaced = s.replace("apps", func() (func() bool, cache.Store, chan struct{}) {
+		t.Error("started an informer for a removed namespace")
+		return testInformer(always)
+	})
+	if replaced {
+		t.Error("replacing a removed namespace reported it's watched")
+	}
+	if watched := s.watched(); len(watched) != 0 {
+		t.Errorf("got watched namespaces %v, expected none", watched)
+	}
+}
+
+func TestServeReady(t *testing.T) {
+	synced := false
+	s := &informerStatus{}
+	hasSynced, store, stop := testInformer(func() bool { return synced })
+	s.add("apps", hasSynced, store, stop)
+	ings := append(testEntries(t, testIngress("apps", "web", "web.example.com", "www.example.com")),
+		testEntries(t, testIngress("apps", "api", "api.example.com"))...)
+	current := func() []ingress { return ings }
+
+	for _, tc := range []struct {
+		name   string
+		synced bool
+		min    int
+		code   int
+	}{
+		{name: "unsynced", synced: false, min: 0, code: http.StatusServiceUnavailable},
+		{name: "no minimum", synced: true, min: 0, code: http.StatusOK},
+		{name: "minimum met", synced: true, min: 2, code: http.StatusOK},
+		{name: "minimum counts Ingresses, not hosts", synced: true, min: 3, code: http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			synced = tc.synced
+			rec := httptest.NewRecorder()
+			serveReady(s, current, tc.min)(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if rec.Code != tc.code {
+				t.Errorf("got %d %q, expected %d", rec.Code, rec.Body.String(), tc.code)
+			}
+		})
+	}
+}
+
+func TestServeNamespaceStatus(t *testing.T) {
+	s := &informerStatus{}
+	hasSynced, store, stop := testInformer(func() bool { return true })
+	s.add("apps", hasSynced, store, stop)
+	hasSynced, store, stop = testInformer(func() bool { return false })
+	s.add("syncing", hasSynced, store, stop)
+	s.skip("forbidden", "ingresses is forbidden")
+	s.seen("apps")
+
+	var ings []ingress
+	ings = append(ings, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	ings = append(ings, testEntries(t, testIngress("apps", "kibana", "kibana.example.com"))...)
+	ings = append(ings, testEntries(t, testIngress("unwatched", "web", "web.example.com"))...)
+
+	rec := httptest.NewRecorder()
+	serveNamespaceStatus(s, func() []ingress { return ings })(rec, httptest.NewRequest("GET", "/debug/namespaces", nil))
+	var got map[string]namespaceStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 {
+		t.Errorf("got %d namespaces, expected apps, syncing and forbidden: %v", len(got), got)
+	}
+	if apps := got["apps"]; !apps.Synced || apps.IngressCount != 2 || apps.LastEventTime == nil {
+		t.Errorf("got apps %+v, expected synced with 2 Ingresses and an event", apps)
+	}
+	if syncing := got["syncing"]; syncing.Synced || syncing.IngressCount != 0 || syncing.LastEventTime != nil {
+		t.Errorf("got syncing %+v, expected unsynced and empty", syncing)
+	}
+	if forbidden := got["forbidden"]; forbidden.Skipped != "ingresses is forbidden" {
+		t.Errorf("got forbidden %+v, expected the reason it's skipped", forbidden)
+	}
+}
+
+func TestReadyWithoutNamespaces(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(s *informerStatus)
+	}{
+		{name: "none configured", setup: func(s *informerStatus) {}},
+		{name: "all skipped", setup: func(s *informerStatus) { s.skip("apps", "ingresses is forbidden") }},
+		{name: "all removed", setup: func(s *informerStatus) {
+			hasSynced, store, stop := testInformer(func() bool { return true })
+			s.add("apps", hasSynced, store, stop)
+			s.remove("apps")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &informerStatus{}
+			tc.setup(s)
+
+			rec := httptest.NewRecorder()
+			serveReady(s, func() []ingress { return nil }, 0)(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "no namespaces are being watched") {
+				t.Errorf("got %d %q, expected 503 as no namespaces are watched", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWaitForSync(t *testing.T) {
+	setFlag(t, &syncPollInterval, time.Millisecond)
+	index := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("index")) })
+	status := func(h http.Handler, path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+	waitFor := func(h http.Handler, code int) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if status(h, "/index/") == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("no namespaces", func(t *testing.T) {
+		s := &informerStatus{}
+		doneChan := make(chan error, 1)
+		h := waitForSync(s, time.Minute, "/index", doneChan, index)
+		if code := status(h, "/index/"); code != http.StatusServiceUnavailable {
+			t.Errorf("got %d before the namespaces were started, expected 503", code)
+		}
+		if code := status(h, "/index/healthz"); code != http.StatusOK {
+			t.Errorf("got %d from /healthz, expected it served straight away", code)
+		}
+		s.markStarted()
+		if !waitFor(h, http.StatusOK) {
+			t.Error("watching no namespaces didn't count as synced")
+		}
+	})
+
+	t.Run("synced", func(t *testing.T) {
+		synced := make(chan struct{})
+		hasSynced, store, stop := testInformer(func() bool {
+			select {
+			case <-synced:
+				return true
+			default:
+				return false
+			}
+		})
+		s := &informerStatus{}
+		s.add("apps", hasSynced, store, stop)
+		s.markStarted()
+		doneChan := make(chan error, 1)
+		h := waitForSync(s, time.Minute, "/index", doneChan, index)
+		if code := status(h, "/index/"); code != http.StatusServiceUnavailable {
+			t.Errorf("got %d while syncing, expected 503", code)
+		}
+		close(synced)
+		if !waitFor(h, http.StatusOK) {
+			t.Error("still unavailable once synced")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		hasSynced, store, stop := testInformer(func() bool { return false })
+		s := &informerStatus{}
+		s.add("apps", hasSynced, store, stop)
+		s.markStarted()
+		doneChan := make(chan error, 1)
+		h := waitForSync(s, 10*time.Millisecond, "/index", doneChan, index)
+
+		var timeout *syncTimeout
+		select {
+		case err := <-doneChan:
+			if !errors.As(err, &timeout) || !strings.Contains(err.Error(), "apps") {
+				t.Errorf("got %v on doneChan, expected a timeout naming apps", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("nothing sent on doneChan after the timeout")
+		}
+		if code := status(h, "/index/"); code != http.StatusServiceUnavailable {
+			t.Errorf("got %d after the timeout, expected 503", code)
+		}
+	})
+}
+
+func TestWarmup(t *testing.T) {
+	synced := false
+	hasSynced, store, stop := testInformer(func() bool { return synced })
+	informers.add("apps", hasSynced, store, stop)
+	t.Cleanup(func() { informers.remove("apps") })
+
+	setFlag(t, flagWarmup, time.Minute)
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+
+	isLoading := func(body string) bool {
+		return strings.Contains(body, "Loading Ingresses") && strings.Contains(body, `http-equiv="refresh"`)
+	}
+	res, body := get(t, srv, "/")
+	if !isLoading(body) || strings.Contains(body, "grafana.example.com") {
+		t.Errorf("before syncing got %q, expected the loading page", body)
+	}
+	if cc := res.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("the loading page has Cache-Control %q, expected no-store", cc)
+	}
+
+	synced = true
+	if _, body := get(t, srv, "/"); isLoading(body) || !strings.Contains(body, `href="http://grafana.example.com"`) {
+		t.Errorf("after syncing got %q, expected the index", body)
+	}
+
+	// once warm it stays that way, e.g. while an informer restarts
+	synced = false
+	if _, body := get(t, srv, "/"); isLoading(body) {
+		t.Error("the loading page came back after the index was shown")
+	}
+
+	// the index is shown after -warmup even when never synced
+	setFlag(t, flagWarmup, time.Millisecond)
+	_, srv = newTestServer(t)
+	time.Sleep(10 * time.Millisecond)
+	if _, body := get(t, srv, "/"); isLoading(body) {
+		t.Error("the loading page was still served after -warmup")
+	}
+}
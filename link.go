@@ -0,0 +1,83 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// linkTemplate builds the href of each entry when -link-template is set
+var linkTemplate *template.Template
+
+// linkData is what a -link-template is executed with.
+type linkData struct {
+	// Ingress is the object the entry is built from
+	Ingress *k8sNetworking.Ingress
+
+	// FQDN is the link we'd otherwise use
+	FQDN string
+}
+
+// parseLinkTemplate parses a -link-template and checks it against a sample
+// Ingress, so mistakes like unknown fields fail at startup. Templates only
+// get the text/template builtins, nothing which can reach the filesystem or
+// network.
+func parseLinkTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("link").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := &k8sNetworking.Ingress{
+		ObjectMeta: k8sMeta.ObjectMeta{Namespace: "default", Name: "example"},
+	}
+	if _, err := executeLink(tpl, sample, "https://example.com"); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// executeLink renders tpl for ing, which must produce an absolute http(s) URL.
+func executeLink(tpl *template.Template, ing *k8sNetworking.Ingress, fqdn string) (string, error) {
+	var buf strings.Builder
+	if err := tpl.Execute(&buf, linkData{Ingress: ing, FQDN: fqdn}); err != nil {
+		return "", err
+	}
+	link := strings.TrimSpace(buf.String())
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q isn't an absolute http(s) URL", link)
+	}
+	return link, nil
+}
+
+// templateLink returns the href -link-template builds for ing, or "" to fall
+// back to the FQDN when it's unset or fails.
+func templateLink(ing *k8sNetworking.Ingress, fqdn string, logf printf) string {
+	if linkTemplate == nil {
+		return ""
+	}
+	link, err := executeLink(linkTemplate, ing, fqdn)
+	if err != nil {
+		logf("WARNING: -link-template failed for %s/%s, using %s, err=%v\n", ing.Namespace, ing.Name, fqdn, err)
+		return ""
+	}
+	return link
+}
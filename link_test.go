@@ -0,0 +1,79 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkTemplate(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"unset", "", "http://web.example.com"},
+		{"query param", "{{.FQDN}}?utm_source=index", "http://web.example.com?utm_source=index"},
+		{"other domain", "https://{{.Ingress.Name}}.{{.Ingress.Namespace}}.internal.example.com", "https://web.apps.internal.example.com"},
+		{"label", `https://example.com/{{index .Ingress.Labels "team"}}`, "https://example.com/platform"},
+		// passes the startup check but not for this Ingress, so falls back
+		{"fails at render", `{{if eq .Ingress.Name "web"}}web{{else}}{{.FQDN}}{{end}}`, "http://web.example.com"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.template != "" {
+				tpl, err := parseLinkTemplate(tc.template)
+				if err != nil {
+					t.Fatal(err)
+				}
+				setFlag(t, &linkTemplate, tpl)
+			}
+
+			ing := testIngress("apps", "web", "web.example.com")
+			ing.Labels = map[string]string{"team": "platform"}
+			var entries []ingress
+			captureOutput(t, func() { entries = testEntries(t, ing) })
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(entries))
+			}
+			if href := entries[0].Href(); href != tc.expected {
+				t.Errorf("got href %q, expected %q", href, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseLinkTemplate(t *testing.T) {
+	cases := []struct {
+		template string
+		err      string
+	}{
+		{"{{.FQDN}}", ""},
+		{"{{.FQDN", "unclosed action"},
+		{"{{.Nope}}", "can't evaluate field Nope"},
+		{"{{.Ingress.Name}}", "isn't an absolute http(s) URL"},
+		{`{{readFile "/etc/passwd"}}`, `function "readFile" not defined`},
+	}
+	for _, tc := range cases {
+		_, err := parseLinkTemplate(tc.template)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%q: unexpected error: %v", tc.template, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%q: got error %v, expected %q", tc.template, err, tc.err)
+		}
+	}
+}
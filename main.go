@@ -23,25 +23,38 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
-	"context"
+	"unicode/utf8"
 
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
 	k8sNetworking "k8s.io/api/networking/v1"
 	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -52,17 +65,125 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 )
 
+// Annotations read from Ingress objects
+const (
+	annotationDescription = "ingress-index.zystem.io/description"
+	annotationTTL         = "ingress-index.zystem.io/ttl"
+	annotationNoFollow    = "ingress-index.zystem.io/nofollow"
+	annotationLinkPath    = "ingress-index.zystem.io/path"
+	annotationLinkPrefix  = "index.k8s.io/link."
+	annotationSchemes     = "ingress-index.zystem.io/schemes"
+	annotationHealthPath  = "ingress-index.zystem.io/health-path"
+	annotationSection     = "ingress-index.zystem.io/section"
+	annotationSkipHealth  = "ingress-index.zystem.io/skip-health-check"
+	annotationSlug        = "ingress-index.zystem.io/slug"
+)
+
 var (
 	// flags
-	flagAddress             = flag.String("address", "0.0.0.0:8080", "Address to listen on")
-	flagForceTLS            = flag.Bool("force-tls", true, "Force all URLs to be HTTPS, even if their Ingress objects has no TLS object")
-	flagKubeconfig          *string
-	flagWatchableNamespaces = flag.String("namespaces", "", "Namespaces to watch (required)")
+	flagAddress                = flag.String("address", "0.0.0.0:8080", "Address to listen on, unless listeners are passed by systemd socket activation")
+	flagAdmin                  = flag.Bool("admin", false, "Serve /admin/config to adjust filters at runtime, requires -admin-token")
+	flagAdminToken             = flag.String("admin-token", "", "Bearer token for the /admin endpoints, or @path to read it from a file. The endpoints are disabled when unset")
+	flagAllHosts               = flag.Bool("all-hosts", false, "List an entry for every host of an Ingress rather than only its first")
+	flagAPICacheControl        = flag.String("api-cache-control", "no-store", "Cache-Control header of the JSON API responses, none when empty")
+	flagBackendPortName        = flag.String("backend-port-name", "", "Only list Ingresses with a path routed to a Service port of this name, e.g. web")
+	flagBasePath               = flag.String("base-path", "", "Path prefix to serve from when behind a proxy, e.g. /index")
+	flagCollisionPolicy        = flag.String("collision-policy", collisionSeparate, "How Ingresses sharing a name or FQDN are listed: separate, merge (one entry with every FQDN) or last-wins")
+	flagDefaultHost            = flag.String("default-host", "", "External address of the Ingress controller, used to link rules without a host")
+	flagDefaultTheme           = flag.String("default-theme", defaultTheme, "Theme to render pages with unless ?theme= picks another: default, dense, grouped or hosts")
+	flagEmptyLink              = flag.String("empty-link", "", "Link shown after -empty-message, e.g. to docs on getting access")
+	flagEmptyMessage           = flag.String("empty-message", "No Ingress objects found", "Message shown when there are no Ingresses to list")
+	flagExtensionsIngresses    = flag.Bool("extensions-ingresses", false, "Also watch extensions/v1beta1 Ingresses, for clusters migrating to networking.k8s.io. Ingresses seen under both are listed once")
+	flagFooterHTML             = flag.String("footer-html", "", "Content for the page footer, or @path to read it from a file")
+	flagFooterTrusted          = flag.Bool("footer-trusted", false, "Render -footer-html as HTML instead of escaping it")
+	flagForceTLS               = flag.Bool("force-tls", false, "Force all URLs to be HTTPS, even if their Ingress objects has no TLS object. Same as -tls-mode=force")
+	flagHostFilters            = flag.String("host-filters", "", "Path to a JSON file mapping request Hosts to the namespaces and Ingress label selector they show")
+	flagIdentityIncludesClass  = flag.Bool("identity-includes-class", false, "Tell apart Ingresses with the same namespace and name but different classes, rather than treating them as one")
+	flagIncludePaths           = flag.Bool("include-paths", false, "Include the path of each Ingress rule in its link")
+	flagInsecureSkipTLSVerify  = flag.Bool("insecure-skip-tls-verify", false, "Don't verify the API server's certificate when using -kubeconfig. Unsafe, for development clusters only")
+	flagItemTemplate           = flag.String("item-template", "", "Template fragment used to render each Ingress in the default page template")
+	flagKubeBurst              = flag.Int("kube-burst", 10, "Maximum burst of requests to the Kubernetes API above -kube-qps")
+	flagKubeQPS                = flag.Float64("kube-qps", 5, "Sustained requests per second allowed to the Kubernetes API")
+	flagKubeconfig             *string
+	flagLinkTemplate           = flag.String("link-template", "", "Go template building each entry's href from .Ingress (the Ingress object) and .FQDN, e.g. {{.FQDN}}?utm_source=index")
+	flagMaintenance            = flag.Bool("maintenance", false, "Start in maintenance mode, showing -maintenance-message on every page")
+	flagMaintenanceLinks       = flag.Bool("maintenance-disable-links", false, "Stop entries linking to their Ingress while in maintenance mode")
+	flagMaintenanceMessage     = flag.String("maintenance-message", "Cluster maintenance is in progress, links may be out of date", "Banner shown on every page in maintenance mode")
+	flagMaxAnnotationLength    = flag.Int("max-annotation-length", 1000, "Longest description, section or display name annotation shown, in characters. Longer values are cut short with an ellipsis. 0 for no limit")
+	flagMinReadyIngresses      = flag.Int("min-ready-ingresses", 0, "Keep /readyz failing until at least this many Ingresses are indexed")
+	flagNamespaceDisplayNames  = flag.Bool("namespace-display-names", false, "Watch Namespaces for the "+annotationDisplayName+" annotation, used as headings by the grouped theme")
+	flagNamespaceLabelData     = flag.String("namespace-label-data", "", "Comma separated namespace labels to render as data-* attributes on each entry")
+	flagNamespaceSelector      = flag.String("namespace-selector", "", "Label selector picking the namespaces to watch, e.g. ingress-index=enabled. Namespaces are watched as they start or stop matching. Replaces -namespaces")
+	flagNamespacesSecret       = flag.String("namespaces-secret", "", "Secret holding more comma separated namespaces to watch, as namespace/name#key. Read at startup")
+	flagNewWindow              = flag.Duration("new-window", 24*time.Hour, "How recently an Ingress must have been created to be shown on /new")
+	flagOutputConfigMap        = flag.String("output-configmap", "", "ConfigMap to write the rendered index to on each change, as namespace/name. The page is stored under index.html and the Ingresses as JSON under ingresses.json")
+	flagOwnerKind              = flag.String("owner-kind", "", "Only list Ingresses with an owner reference of this kind, e.g. Application, or kind.group to match its API group too, e.g. Application.argoproj.io")
+	flagPreserveHostCase       = flag.Bool("preserve-host-case", false, "Link to hosts as they're written in the Ingress rather than lowercased")
+	flagPrintConfig            = flag.Bool("print-config", false, "Print the effective flag values as JSON and exit without contacting the cluster")
+	flagProbeInterval          = flag.Duration("probe-interval", 0, "How often to check each link is reachable, disabled when 0")
+	flagProbeTimeout           = flag.Duration("probe-timeout", 5*time.Second, "Timeout for each reachability check")
+	flagRecentWindow           = flag.Duration("recent-window", 0, "Show a \"Recently changed\" section with the entries updated within this long, e.g. 30m. Disabled when zero")
+	flagRenderInterval         = flag.Duration("render-interval", 0, "Minimum time between renders of the index, changes within it are batched together")
+	flagRequireLB              = flag.Bool("require-lb", false, "Skip Ingresses until the controller has assigned them a load balancer address")
+	flagResyncInterval         = flag.Duration("resync-interval", 60*time.Second, "How often informers re-deliver every object, 0 disables resyncs and relies on watch events alone")
+	flagRewriteAnnotations     = flag.String("rewrite-annotations", "nginx.ingress.kubernetes.io/rewrite-target", "Comma separated annotations which mark an Ingress's paths as rewritten (regex) paths")
+	flagRobotsTxt              = flag.String("robots-txt", "", "Path to a robots.txt replacing the default, which asks crawlers not to index anything")
+	flagShowAnnotations        = flag.Bool("show-annotations", false, "Show each Ingress's annotations with its entry, collapsed when there are many")
+	flagShutdownTimeout        = flag.Duration("shutdown-timeout", 10*time.Second, "How long to wait for in-flight requests to finish when shutting down")
+	flagSkipAccessCheck        = flag.Bool("skip-access-check", false, "Skip checking list/watch permissions on Ingresses at startup")
+	flagSnapshotBuffer         = flag.Int("snapshot-buffer", 10, "How many snapshots of the index can wait to be rendered before the oldest is dropped")
+	flagSnapshotFile           = flag.String("snapshot-file", "", "File to write the rendered index to on each change, for another web server to serve. It's replaced atomically")
+	flagSnapshotInterval       = flag.Duration("snapshot-interval", time.Minute, "How often -snapshot-file is rewritten besides each change, keeping times on the page current. 0 only writes on changes")
+	flagSortBy                 = flag.String("sort-by", sortByName, "Order of the namespace groups in the grouped theme: name or namespace-count (most Ingresses first)")
+	flagSortLocale             = flag.String("sort-locale", "", "Locale to sort entries by, e.g. de or fr-CA (default sorts by lowercased name)")
+	flagSSLRedirectAnnotations = flag.String("ssl-redirect-annotations", defaultSSLRedirectAnnotations, "Comma separated annotations which, when true, mean the controller serves the Ingress over https")
+	flagStaticLinks            = flag.String("static-links", "", "ConfigMap of static links to list alongside Ingresses, as namespace/name. Each key names a link and its value is the URL")
+	flagStylesheet             = flag.String("stylesheet", "", "Path to a CSS file replacing the default page styles")
+	flagTLSMode                = flag.String("tls-mode", "", "How to pick the scheme of links: force (always https) or auto (https when the host has TLS or an -ssl-redirect-annotations is true). Defaults to auto, or force with -force-tls")
+	flagTemplate               = flag.String("template", "", "Path to a custom page template, replacing the default theme")
+	flagTemplateRoutes         = flag.String("template-routes", "", "Comma separated path=template pairs to serve additional pages, e.g. /exec=exec.html")
+	flagTraceExemplars         = flag.Bool("trace-exemplars", false, "Attach the trace ID of sampled requests with a W3C traceparent header as exemplars on the request duration histogram, exposed when /metrics is scraped as OpenMetrics")
+	flagTrailingSlash          = flag.String("trailing-slash", "preserve", "Trailing slash handling for links: preserve, add or strip")
+	flagTrustedDescriptions    = flag.Bool("trusted-descriptions", false, "Render description annotations as HTML instead of escaping them")
+	flagTrustedProxies         = flag.String("trusted-proxies", "", "Comma separated CIDRs of reverse proxies whose X-Forwarded-Proto and X-Forwarded-Host headers are used for links back to the index")
+	flagWaitForSync            = flag.Bool("wait-for-sync", false, "Answer requests for the index with 503 until every namespace's informer has synced, health endpoints are served straight away")
+	flagWaitForSyncTimeout     = flag.Duration("wait-for-sync-timeout", 5*time.Minute, "How long -wait-for-sync waits before exiting with an error")
+	flagWarmup                 = flag.Duration("warmup", 0, "Serve a loading page which refreshes itself instead of the index until every namespace's informer has synced, for at most this long. 0 disables")
+	flagWatchableNamespaces    = flag.String("namespaces", "", "Namespaces to watch (required unless running in-cluster)")
+	flagWatchdogTimeout        = flag.Duration("watchdog-timeout", 15*time.Minute, "Restart a namespace's informer when it delivers no events, resyncs included, for this long. 0 disables")
+	flagWebhookTimeout         = flag.Duration("webhook-timeout", 10*time.Second, "Timeout for each request to -webhook-url")
+	flagWebhookURL             = flag.String("webhook-url", "", "URL to POST the Ingresses to as JSON each time they change")
 
 	// default settings
-	resyncInterval = 60 * time.Second
+	ttlSweepInterval = 10 * time.Second
+
+	// now is the clock used for expiring entries
+	now = time.Now
+
+	// annotations common controllers use to redirect http traffic to https,
+	// for nginx, traefik and haproxy
+	defaultSSLRedirectAnnotations = strings.Join([]string{
+		"nginx.ingress.kubernetes.io/ssl-redirect",
+		"nginx.ingress.kubernetes.io/force-ssl-redirect",
+		"ingress.kubernetes.io/ssl-redirect",
+		"traefik.ingress.kubernetes.io/router.tls",
+	}, ",")
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
 	ctx context.Context = context.Background()
+
+	// metadata from watched Namespace objects
+	namespaceMeta = &namespaceIndex{}
+
+	// state of the Ingress informer in each watched namespace
+	informers = &informerStatus{}
+
+	// switched on by -maintenance or /admin/maintenance
+	maintenance = &maintenanceMode{}
+
+	// probes each FQDN, nil unless -probe-interval is set
+	reachability *prober
 )
 
 func main() {
@@ -73,36 +194,190 @@ func main() {
 	}
 	flag.Parse()
 
-	// validation
-	var watchableNamespaces = strings.Split(*flagWatchableNamespaces, ",")
-	if *flagWatchableNamespaces == "" {
-		ns := os.Getenv("NAMESPACES")
-		flagWatchableNamespaces = &ns
+	switch *flagTrailingSlash {
+	case "preserve", "add", "strip":
+	default:
+		panic(fmt.Sprintf("unknown -trailing-slash mode %q", *flagTrailingSlash))
 	}
-	if *flagWatchableNamespaces == "" || len(watchableNamespaces) == 0 {
-		panic("You need to specify -namespaces for namespaces to watch")
+
+	if *flagEmptyLink != "" {
+		if u, err := url.Parse(*flagEmptyLink); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			panic(fmt.Sprintf("invalid -empty-link %q, it must be an http(s) URL", *flagEmptyLink))
+		}
+	}
+
+	if *flagStaticLinks != "" {
+		if ns, name, ok := strings.Cut(*flagStaticLinks, "/"); !ok || ns == "" || name == "" {
+			panic(fmt.Sprintf("invalid -static-links %q, expected namespace/name", *flagStaticLinks))
+		}
+	}
+
+	if *flagNamespacesSecret != "" {
+		if _, _, _, err := parseSecretRef(*flagNamespacesSecret); err != nil {
+			panic(fmt.Sprintf("invalid -namespaces-secret, err=%v", err))
+		}
+	}
+
+	if *flagOutputConfigMap != "" {
+		if ns, name, ok := strings.Cut(*flagOutputConfigMap, "/"); !ok || ns == "" || name == "" {
+			panic(fmt.Sprintf("invalid -output-configmap %q, expected namespace/name", *flagOutputConfigMap))
+		}
+	}
+
+	if *flagOwnerKind != "" {
+		if kind, _ := splitKindGroup(*flagOwnerKind); kind == "" {
+			panic(fmt.Sprintf("invalid -owner-kind %q, expected kind or kind.group", *flagOwnerKind))
+		}
+	}
+
+	if *flagLinkTemplate != "" {
+		tpl, err := parseLinkTemplate(*flagLinkTemplate)
+		if err != nil {
+			panic(fmt.Sprintf("invalid -link-template, err=%v", err))
+		}
+		linkTemplate = tpl
+	}
+
+	if *flagTrustedProxies != "" {
+		networks, err := parseTrustedProxies(*flagTrustedProxies)
+		if err != nil {
+			panic(fmt.Sprintf("invalid -trusted-proxies, err=%v", err))
+		}
+		trustedProxies = networks
+	}
+
+	if *flagSnapshotBuffer < 1 {
+		panic(fmt.Sprintf("-snapshot-buffer must be at least 1, got %d", *flagSnapshotBuffer))
+	}
+
+	switch *flagCollisionPolicy {
+	case collisionSeparate, collisionMerge, collisionLastWins:
+	default:
+		panic(fmt.Sprintf("unknown -collision-policy %q", *flagCollisionPolicy))
+	}
+
+	switch *flagSortBy {
+	case sortByName, sortByNamespaceCount:
+	default:
+		panic(fmt.Sprintf("unknown -sort-by %q", *flagSortBy))
+	}
+
+	switch tlsMode() {
+	case tlsModeForce, tlsModeAuto:
+	default:
+		panic(fmt.Sprintf("unknown -tls-mode %q", *flagTLSMode))
+	}
+	if *flagSortLocale != "" {
+		if _, err := language.Parse(*flagSortLocale); err != nil {
+			panic(fmt.Sprintf("invalid -sort-locale %q, err=%v", *flagSortLocale, err))
+		}
+	}
+
+	*flagWatchableNamespaces = namespacesFlag(*flagWatchableNamespaces, os.Getenv)
+
+	maintenance.set(*flagMaintenance)
+
+	if *flagPrintConfig {
+		if err := printConfig(os.Stdout, flag.CommandLine); err != nil {
+			panic(fmt.Sprintf("error printing config, err=%v", err))
+		}
+		os.Exit(0)
 	}
-	sort.Strings(watchableNamespaces)
-	fmt.Printf("watching namespaces: %s\n", strings.Join(watchableNamespaces, ", "))
 
 	// try and get config from cluster
 	config, err := rest.InClusterConfig()
+	inCluster := err == nil
 	if err != nil {
 		// read config from -kubeconfig flag
 		config, err = clientcmd.BuildConfigFromFlags("", *flagKubeconfig)
 		if err != nil {
 			panic(fmt.Sprintf("error reading config, err=%v", err))
 		}
+		if *flagInsecureSkipTLSVerify {
+			skipTLSVerify(config)
+		}
+	} else if *flagInsecureSkipTLSVerify {
+		fmt.Println("ignoring -insecure-skip-tls-verify, it only applies to -kubeconfig")
 	}
 
+	// client-go throttles requests to 5 qps with a burst of 10 unless told
+	// otherwise, which slows down the initial list across many namespaces.
+	if *flagKubeQPS <= 0 || *flagKubeBurst <= 0 {
+		panic(fmt.Sprintf("-kube-qps and -kube-burst must be positive, got %v and %d", *flagKubeQPS, *flagKubeBurst))
+	}
+	config.QPS = float32(*flagKubeQPS)
+	config.Burst = *flagKubeBurst
+
 	// create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		panic(fmt.Sprintf("error setting up Kubernetes API client, err=%v", err))
 	}
 
+	// validation
+	if *flagNamespaceSelector != "" {
+		if _, err := labels.Parse(*flagNamespaceSelector); err != nil {
+			panic(fmt.Sprintf("invalid -namespace-selector %q, err=%v", *flagNamespaceSelector, err))
+		}
+		if *flagWatchableNamespaces != "" || *flagNamespacesSecret != "" {
+			fmt.Println("ignoring -namespaces and -namespaces-secret, -namespace-selector picks the namespaces to watch")
+			*flagWatchableNamespaces = ""
+			*flagNamespacesSecret = ""
+		}
+	} else if *flagWatchableNamespaces == "" && *flagNamespacesSecret == "" && inCluster {
+		// fall back to the namespace our pod is running in
+		ns, err := podNamespace()
+		if err != nil {
+			fmt.Printf("unable to read pod namespace, err=%v\n", err)
+		}
+		flagWatchableNamespaces = &ns
+	}
+	var watchableNamespaces = parseList(*flagWatchableNamespaces)
+	if *flagNamespacesSecret != "" {
+		fromSecret, err := secretNamespaces(clientset, *flagNamespacesSecret)
+		if err != nil {
+			panic(fmt.Sprintf("error reading -namespaces-secret, err=%v", err))
+		}
+		for _, ns := range fromSecret {
+			if !containsString(watchableNamespaces, ns) {
+				watchableNamespaces = append(watchableNamespaces, ns)
+			}
+		}
+	}
+	if *flagNamespaceSelector == "" {
+		if err := requireNamespaces(watchableNamespaces); err != nil {
+			panic(err.Error())
+		}
+	}
+	sort.Strings(watchableNamespaces)
+	if *flagNamespaceSelector != "" {
+		fmt.Printf("watching namespaces matching: %s\n", *flagNamespaceSelector)
+	} else {
+		fmt.Printf("watching namespaces: %s\n", strings.Join(watchableNamespaces, ", "))
+	}
+
+	if !*flagSkipAccessCheck {
+		checkIngressAccess(clientset, watchableNamespaces)
+	}
+
+	if *flagOutputConfigMap != "" {
+		ns, name, _ := strings.Cut(*flagOutputConfigMap, "/")
+		if !*flagSkipAccessCheck {
+			checkConfigMapAccess(clientset, ns, name)
+		}
+		configMapOutput = newConfigMapWriter(clientset, ns, name)
+	}
+
+	if *flagSnapshotFile != "" {
+		fileOutput = newFileWriter(*flagSnapshotFile, *flagSnapshotInterval)
+	}
+
+	if *flagNamespaceLabelData != "" || *flagNamespaceDisplayNames {
+		watchNamespaces(clientset, namespaceMeta)
+	}
+
 	// ingress
-	respChan := make(chan []ingress, 10)
+	respChan := make(chan []ingress, *flagSnapshotBuffer)
 	go watchIngresses(clientset, watchableNamespaces, respChan)
 
 	// catch signals
@@ -112,7 +387,30 @@ func main() {
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
 	// setup http page
-	listenHTTP(*flagAddress, respChan, doneChan)
+	var timeout *syncTimeout
+	if err := listenHTTP(*flagAddress, respChan, doneChan); errors.As(err, &timeout) {
+		os.Exit(1)
+	}
+}
+
+// errNoNamespaces is returned when nothing gives a namespace to watch.
+var errNoNamespaces = errors.New("no namespaces to watch, you need to specify -namespaces")
+
+// namespacesFlag returns the -namespaces value, or the NAMESPACES environment
+// variable read with getenv when it's unset. Whitespace alone counts as unset.
+func namespacesFlag(value string, getenv func(key string) string) string {
+	if value = strings.TrimSpace(value); value != "" {
+		return value
+	}
+	return strings.TrimSpace(getenv("NAMESPACES"))
+}
+
+// requireNamespaces returns errNoNamespaces when namespaces is empty.
+func requireNamespaces(namespaces []string) error {
+	if len(namespaces) == 0 {
+		return errNoNamespaces
+	}
+	return nil
 }
 
 func homeDir() string {
@@ -122,6 +420,24 @@ func homeDir() string {
 	return os.Getenv("USERPROFILE") // windows
 }
 
+// skipTLSVerify stops config from verifying the API server's certificate.
+func skipTLSVerify(config *rest.Config) {
+	fmt.Println("WARNING: -insecure-skip-tls-verify is set, the Kubernetes API server's certificate will NOT be verified. Never use this outside of development clusters.")
+	config.TLSClientConfig.Insecure = true
+	// client-go refuses a CA alongside Insecure
+	config.TLSClientConfig.CAFile = ""
+	config.TLSClientConfig.CAData = nil
+}
+
+// podNamespace returns the namespace of the service account mounted into our pod.
+func podNamespace() (string, error) {
+	bs, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
 func handleSignals(signalChan chan os.Signal, doneChan chan error) {
 	for s := range signalChan {
 		doneChan <- fmt.Errorf("shutdown initiated, signal=%v", s)
@@ -129,225 +445,1727 @@ func handleSignals(signalChan chan os.Signal, doneChan chan error) {
 	}
 }
 
-var pageContent = `<!doctype html>
-<html>
-  <head>
-    <title>kube-ingress-index</title>
-    <meta name="viewport" content="width=device-width, initial-scale=1">
-  </head>
-  <body>
-    <h2>kube-ingress-index</h2>
-    <ul>
-      {{range $ing := .Ingresses}}
-        <li>{{ $ing.Namespace }} / <a href="{{ $ing.FQDN }}">{{ $ing.Name }}</a></li>
-      {{else}}
-      <li>No Ingress objects found</li>
-      {{end}}
-    </ul>
-  </body>
-</html>`
-
-func listenHTTP(address string, respChan chan []ingress, doneChan chan error) {
-	var curIngresses []ingress
+// webFS holds the default page template and its static assets so the binary
+// can run without any files on disk.
+//
+//go:embed web
+var webFS embed.FS
+
+// loadTemplate parses the page template from path, or the embedded template
+// of the default theme when path is empty.
+func loadTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return loadTheme(defaultTheme)
+	}
+	tpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if *flagItemTemplate != "" {
+		if tpl, err = withItemTemplate(tpl, *flagItemTemplate); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateTemplate(tpl); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return tpl, nil
+}
+
+// sampleIngress is a representative entry with every field set, for checking
+// templates against.
+func sampleIngress() ingress {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return ingress{
+		Name:        "example",
+		Namespace:   "default",
+		FQDN:        "https://example.com",
+		Class:       "nginx",
+		TLS:         true,
+		Created:     created,
+		UpdatedAt:   created,
+		Description: "An example",
+		Section:     "Examples",
+		Status:      statusUp,
+		Anchor:      "default_example",
+		Source:      sourceIngress,
+		MergedFQDNs: []string{"https://example.org"},
+		Conflicts:   []string{"other/example"},
+		Path:        "/",
+		Links:       map[string]string{"docs": "https://example.com/docs"},
+		Rules:       1,
+		Paths:       1,
+	}
+}
+
+// validateTemplate executes tpl against a sample page, so a template using a
+// field which doesn't exist, e.g. after it's been renamed, is rejected when
+// it's loaded rather than failing every request.
+func validateTemplate(tpl *template.Template) error {
+	sample := pageData{
+		Ingresses:    []ingress{sampleIngress()},
+		BasePath:     "/index",
+		BaseURL:      "https://index.example.com/index",
+		EmptyMessage: *flagEmptyMessage,
+		Maintenance:  *flagMaintenanceMessage,
+	}
+	if err := tpl.Execute(io.Discard, sample); err != nil {
+		return fmt.Errorf("executing against a sample page: %v", err)
+	}
+	return nil
+}
+
+// withItemTemplate replaces the "item" template, which renders each ingress,
+// with fragment. The fragment is executed against a sample ingress so errors
+// surface at startup rather than on each request.
+func withItemTemplate(tpl *template.Template, fragment string) (*template.Template, error) {
+	if _, err := tpl.New("item").Parse(fragment); err != nil {
+		return nil, fmt.Errorf("parsing item template: %v", err)
+	}
+	if err := tpl.ExecuteTemplate(io.Discard, "item", sampleIngress()); err != nil {
+		return nil, fmt.Errorf("executing item template: %v", err)
+	}
+	return tpl, nil
+}
+
+// listenHTTP serves the index until the error ending it is received on
+// doneChan, and returns it once requests have drained.
+func listenHTTP(address string, respChan chan []ingress, doneChan chan error) error {
+	idx := newIndex()
+
+	handlers, err := newHandler(idx)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	// reload templates from disk on SIGHUP
+	reloadChan := make(chan os.Signal, 1)
+	go reloadOnSignal(reloadChan, handlers.templates)
+	signal.Notify(reloadChan, syscall.SIGHUP)
 
 	srv := &http.Server{
 		Addr: address,
 	}
+	srv.RegisterOnShutdown(idx.events.close)
+
+	var (
+		inFlight     int64
+		shutdownErr  error
+		shutdownDone = make(chan struct{})
+	)
+
+	if *flagWebhookURL != "" {
+		go newWebhook(*flagWebhookURL, *flagWebhookTimeout).watch(idx.events)
+	}
+	if configMapOutput != nil {
+		configMapOutput.render = handlers.render
+		go configMapOutput.watch(idx.events)
+	}
+	if fileOutput != nil {
+		fileOutput.render = handlers.render
+		go fileOutput.watch(idx.events, idx.current)
+	}
+
+	if *flagProbeInterval > 0 {
+		reachability = newProber(*flagProbeTimeout)
+		go reachability.run(*flagProbeInterval, idx.current)
+	}
 
 	go func() {
-		for {
-			select {
-			case err := <-doneChan:
-				fmt.Println(err.Error())
-				srv.Shutdown(nil)
-				return
+		shutdownErr = renderLoop(respChan, doneChan, *flagRenderInterval, idx.set)
+		fmt.Println(shutdownErr.Error())
+		shutdown(srv, &inFlight)
+		close(shutdownDone)
+	}()
+
+	var handler http.Handler = handlers
+	if *flagWaitForSync {
+		handler = waitForSync(informers, *flagWaitForSyncTimeout, cleanBasePath(*flagBasePath), doneChan, handler)
+	}
+
+	srv.Handler = countInFlight(&inFlight, observeRequests(handler))
+
+	// Listeners passed by systemd socket activation replace -address.
+	listeners, err := activatedListeners()
+	if err != nil {
+		panic(err.Error())
+	}
+	if len(listeners) > 0 {
+		err = serveListeners(srv, listeners)
+	} else {
+		fmt.Printf("listening on %s\n", address)
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		fmt.Printf("error serving HTTP, err=%v\n", err)
+		return err
+	}
+	<-shutdownDone
+	return shutdownErr
+}
+
+// countInFlight tracks the number of requests being handled by next.
+func countInFlight(n *int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(n, 1)
+		defer atomic.AddInt64(n, -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdown stops srv from accepting requests and waits up to -shutdown-timeout
+// for those in flight to finish.
+func shutdown(srv *http.Server, inFlight *int64) {
+	fmt.Printf("draining %d in-flight requests\n", atomic.LoadInt64(inFlight))
+
+	ctx, cancel := context.WithTimeout(context.Background(), *flagShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		fmt.Printf("shutdown timed out with %d requests in flight, err=%v\n", atomic.LoadInt64(inFlight), err)
+		return
+	}
+	fmt.Println("all requests drained")
+}
+
+// renderLoop renders each snapshot from respChan straight away, unless one
+// was rendered within the last interval, then they're coalesced and only the
+// latest is rendered once the interval is up. It returns the error received
+// on doneChan.
+func renderLoop(respChan chan []ingress, doneChan chan error, interval time.Duration, render func(ings []ingress)) error {
+	var (
+		lastRender time.Time
+		pending    []ingress
+		flush      <-chan time.Time
+	)
+	for {
+		select {
+		case err := <-doneChan:
+			return err
 
-			case cur := <-respChan:
-				curIngresses = cur
-				sortIngresses(curIngresses)
+		case cur := <-respChan:
+			if wait := interval - time.Since(lastRender); wait > 0 {
+				pending = cur
+				if flush == nil {
+					flush = time.After(wait)
+				}
+				continue
 			}
-		}
-	}()
+			render(cur)
+			lastRender = time.Now()
 
-	tpl := template.Must(template.New("contents").Parse(pageContent))
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		err := tpl.Execute(w, struct {
-			Ingresses []ingress
-		}{
-			Ingresses: curIngresses,
-		})
-		if err != nil {
-			http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		case <-flush:
+			render(pending)
+			lastRender = time.Now()
+			pending, flush = nil, nil
 		}
 	}
+}
 
-	fmt.Printf("listening on %s\n", address)
-	http.HandleFunc("/", handler)
-	srv.ListenAndServe()
+// builtinRoutes are served by newHandler whatever -template-routes says, so
+// templates can't be routed to them. "/" and "/new" can be replaced.
+var builtinRoutes = []string{
+	"/export.csv", "/export.jsonl",
+	"/api/ingresses", "/api/live", "/api/summary", "/api/namespaces", "/healthsummary.json",
+	"/go", "/events", "/metrics",
+	"/debug/namespaces", "/debug/conflicts",
+	"/healthz", "/readyz",
+	"/admin/maintenance", "/admin/config",
+	"/robots.txt", "/favicon.svg",
 }
 
-func sortIngresses(ing []ingress) {
-	sort.Slice(ing, func(i, j int) bool {
-		return strings.ToLower(ing[i].String()) < strings.ToLower(ing[j].String())
+// cleanBasePath normalizes the -base-path flag into "/prefix" form, or "" when
+// serving from the root.
+func cleanBasePath(in string) string {
+	in = strings.Trim(in, "/")
+	if in == "" {
+		return ""
+	}
+	return "/" + in
+}
+
+// withBasePath serves next under prefix, as if it were mounted at the root.
+func withBasePath(prefix string, next http.Handler) http.Handler {
+	strip := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix {
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+			return
+		}
+		strip.ServeHTTP(w, r)
 	})
 }
 
-func ingressListFunc(c *kubernetes.Clientset, ns string) func(k8sMeta.ListOptions) (runtime.Object, error) {
-	return func(opts k8sMeta.ListOptions) (runtime.Object, error) {
-		return c.NetworkingV1().Ingresses(ns).List(ctx, opts)
+// anchorID returns the id linking to the entry of namespace/name within a
+// page, e.g. "apps_grafana". Namespaces and names can't contain '_', so
+// different Ingresses never share one.
+func anchorID(namespace, name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, namespace+"_"+name)
+}
+
+// decorateIngresses returns a copy of ings with render-time fields filled in.
+func decorateIngresses(ings []ingress) []ingress {
+	labelKeys := parseList(*flagNamespaceLabelData)
+	anchors := make(map[string]int)
+	out := make([]ingress, len(ings))
+	for i := range ings {
+		out[i] = ings[i]
+		out[i].Anchor = anchorID(ings[i].Namespace, ings[i].Name)
+		if anchors[out[i].Anchor]++; anchors[out[i].Anchor] > 1 {
+			// further entries of the same Ingress, e.g. one per scheme
+			out[i].Anchor += fmt.Sprintf("-%d", anchors[out[i].Anchor])
+		}
+		out[i].DataAttrs = namespaceMeta.dataAttrs(ings[i].Namespace, labelKeys)
+		out[i].Status = statusUnknown
+		if !ings[i].skipProbe {
+			out[i].Status = reachability.status(ings[i].probeURL())
+		}
 	}
+	return out
 }
 
-func ingressWatchFunc(c *kubernetes.Clientset, ns string) func(options k8sMeta.ListOptions) (watch.Interface, error) {
-	return func(options k8sMeta.ListOptions) (watch.Interface, error) {
-		return c.NetworkingV1().Ingresses(ns).Watch(ctx, options)
+// sinceParam reads the ?since= duration from r, returning def when unset.
+func sinceParam(r *http.Request, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
 	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %v", d)
+	}
+	return d, nil
 }
 
-// TODO(adam): return multiple FQDN's
-func buildFQDN(ing *k8sNetworking.Ingress) string {
-	tlsHosts := make(map[string]bool)
-	spec := ing.Spec
-	for i := range spec.TLS {
-		for j := range spec.TLS[i].Hosts {
-			tlsHosts[spec.TLS[i].Hosts[j]] = true
-		}
+// filterRequest applies the filter of sites for the Host of r and those
+// given in its query to ings.
+func filterRequest(sites *hostFilters, r *http.Request, ings []ingress) ([]ingress, error) {
+	ings = sites.forRequest(r).apply(ings)
+	since, err := sinceParam(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if since > 0 {
+		ings = createdSince(ings, time.Now().Add(-since))
+	}
+	q := r.URL.Query()
+	if ns := q.Get("namespace"); ns != "" {
+		ings = inNamespace(ings, ns)
+	}
+	if name := q.Get("name"); name != "" {
+		ings = nameContains(ings, name)
 	}
+	return ings, nil
+}
 
-	for i := range spec.Rules {
-		host := spec.Rules[i].Host
+// inNamespace returns the ingresses in namespace ns.
+func inNamespace(ings []ingress, ns string) []ingress {
+	var out []ingress
+	for i := range ings {
+		if ings[i].Namespace == ns {
+			out = append(out, ings[i])
+		}
+	}
+	return out
+}
 
-		var u *url.URL
-		if *flagForceTLS || tlsHosts[host] {
-			u, _ = url.Parse(fmt.Sprintf("https://%s", host))
-		} else {
-			u, _ = url.Parse(fmt.Sprintf("http://%s", host))
+// nameContains returns the ingresses whose name contains sub, ignoring case.
+func nameContains(ings []ingress, sub string) []ingress {
+	sub = strings.ToLower(sub)
+	var out []ingress
+	for i := range ings {
+		if strings.Contains(strings.ToLower(ings[i].Name), sub) {
+			out = append(out, ings[i])
 		}
-		if u == nil || u.Host == "" || strings.HasPrefix(u.Host, "localhost:") { // ignore invalid rules/hosts
-			continue
+	}
+	return out
+}
+
+// createdSince returns the ingresses created after t.
+func createdSince(ings []ingress, t time.Time) []ingress {
+	var out []ingress
+	for i := range ings {
+		if ings[i].Created.After(t) {
+			out = append(out, ings[i])
 		}
+	}
+	return out
+}
 
-		return u.String()
+// updatedSince returns the ingresses updated after t, most recent first.
+func updatedSince(ings []ingress, t time.Time) []ingress {
+	var out []ingress
+	for i := range ings {
+		if ings[i].UpdatedAt.After(t) {
+			out = append(out, ings[i])
+		}
 	}
-	return ""
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].UpdatedAt.After(out[j].UpdatedAt)
+	})
+	return out
 }
 
-func buildIngress(ing *k8sNetworking.Ingress) (*ingress, error) {
-	fqdn := buildFQDN(ing)
-	if fqdn == "" {
-		return nil, errors.New("empty FQDN")
+// lastUpdated returns when obj was last changed, the latest time a field
+// manager wrote to it other than the status, or its creation when managed
+// fields aren't available.
+func lastUpdated(obj k8sMeta.ObjectMeta) time.Time {
+	out := obj.CreationTimestamp.Time
+	for _, field := range obj.ManagedFields {
+		if field.Subresource == "status" || field.Time == nil {
+			continue
+		}
+		if field.Time.After(out) {
+			out = field.Time.Time
+		}
 	}
-	return &ingress{
-		Namespace: ing.Namespace,
-		Name:      ing.Name,
-		FQDN:      fqdn,
-	}, nil
+	return out
 }
 
-// ingress is a smaller model for internal shipping about
-type ingress struct {
-	Name, Namespace string
+// pageData is passed to page templates when rendering.
+type pageData struct {
+	Ingresses []ingress
 
-	// FQDN is an address which the backend is reachable from
-	FQDN string
+	// Since is set when only recently created Ingresses are shown
+	Since time.Duration
+
+	// BasePath prefixes links to our own pages, e.g. "/index"
+	BasePath string
+
+	// BaseURL is the absolute URL of the index, e.g.
+	// "https://index.example.com/index", as seen by clients
+	BaseURL string
+
+	// EmptyMessage is shown when there are no Ingresses, followed by
+	// EmptyLink when it's set
+	EmptyMessage string
+	EmptyLink    string
+
+	// Stylesheet is the CSS for the page
+	Stylesheet template.CSS
+
+	// Footer is optional content shown at the bottom of the page
+	Footer template.HTML
+
+	// Maintenance is the banner shown in maintenance mode, empty otherwise
+	Maintenance string
 }
 
-func (ing ingress) String() string {
-	return fmt.Sprintf("Ingress: namespace=%s, name=%s, fqdn=%s", ing.Namespace, ing.Name, ing.FQDN)
+// Summary counts the Ingresses on the page by scheme and TLS.
+func (p pageData) Summary() summary {
+	return summarize(p.Ingresses)
 }
 
-type ingresses struct {
-	// current set of Ingress objects
-	active []ingress
-	mu     sync.Mutex
+// Recent returns the Ingresses updated within -recent-window, most recent
+// first. It's empty when the window isn't set.
+func (p pageData) Recent() []ingress {
+	if *flagRecentWindow <= 0 {
+		return nil
+	}
+	return updatedSince(p.Ingresses, now().Add(-*flagRecentWindow))
 }
 
-func (i *ingresses) upsert(ing ingress) []ingress {
-	i.mu.Lock()
-	defer i.mu.Unlock()
+// Groups returns the Ingresses split by namespace, headed by each namespace's
+// display name.
+func (p pageData) Groups() []namespaceGroup {
+	return namespaceMeta.groupByNamespace(p.Ingresses)
+}
 
-	found := false
-	for k := range i.active {
-		if i.active[k].Name == ing.Name {
-			found = true
-			break // we've already added this ingress
-		}
-	}
-	if !found { // didn't find our ingress, add it and return
-		i.active = append(i.active, ing)
+// Hosts returns the paths routed by the Ingresses, grouped by host.
+func (p pageData) Hosts() []hostGroup {
+	return groupByHost(p.Ingresses)
+}
+
+// loadRobots reads the robots.txt at path, or the embedded default which
+// disallows everything when path is empty.
+func loadRobots(path string) ([]byte, error) {
+	if path == "" {
+		return webFS.ReadFile("web/robots.txt")
 	}
+	return os.ReadFile(path)
+}
 
-	// return a copy
-	out := make([]ingress, len(i.active))
-	copy(out, i.active)
-	return out
+// loadStylesheet reads the CSS file at path, or the embedded default when
+// path is empty.
+func loadStylesheet(path string) (template.CSS, error) {
+	var bs []byte
+	var err error
+	if path == "" {
+		bs, err = webFS.ReadFile("web/style.css")
+	} else {
+		bs, err = os.ReadFile(path)
+	}
+	return template.CSS(bs), err
 }
 
-func (i *ingresses) delete(ing ingress) []ingress {
-	i.mu.Lock()
-	defer i.mu.Unlock()
+// loadFooter returns the footer content, read from a file when in is prefixed
+// with '@'. Content is escaped unless trusted.
+func loadFooter(in string, trusted bool) (template.HTML, error) {
+	if strings.HasPrefix(in, "@") {
+		bs, err := os.ReadFile(in[1:])
+		if err != nil {
+			return "", err
+		}
+		in = string(bs)
+	}
+	if trusted {
+		return template.HTML(in), nil
+	}
+	return template.HTML(template.HTMLEscapeString(in)), nil
+}
 
-	var next []ingress
-	for k := range i.active {
-		if i.active[k].Name == ing.Name {
+// parseTemplateRoutes reads a comma separated list of path=template pairs,
+// e.g. "/exec=exec.html,/=index.html". Paths are kept without a trailing
+// slash, as both spellings are served, and must not repeat or be one of
+// builtinRoutes.
+func parseTemplateRoutes(in string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, pair := range strings.Split(in, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
 			continue
 		}
-		next = append(next, i.active[k])
+		idx := strings.Index(pair, "=")
+		if idx < 1 || idx == len(pair)-1 {
+			return nil, fmt.Errorf("invalid route %q, expected path=template", pair)
+		}
+		path, file := pair[:idx], pair[idx+1:]
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route path %q must start with /", path)
+		}
+		if path != "/" {
+			path = strings.TrimSuffix(path, "/")
+		}
+		if containsString(builtinRoutes, path) || strings.HasPrefix(path, "/go/") {
+			return nil, fmt.Errorf("route path %q is already served", pair[:idx])
+		}
+		if _, ok := routes[path]; ok {
+			return nil, fmt.Errorf("route path %q is given more than once", pair[:idx])
+		}
+		routes[path] = file
 	}
-	i.active = next
-
-	// return a copy
-	out := make([]ingress, len(i.active))
-	copy(out, i.active)
-	return out
+	return routes, nil
 }
 
-func watchIngresses(kubeClient *kubernetes.Clientset, namespaces []string, respChan chan []ingress) {
-	// Internal accumulator, a copy is sent back each time
-	accum := &ingresses{}
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
 
-	ingEventHandler := cache.ResourceEventHandlerFuncs{
+// sortIngresses orders ing by namespace, name and FQDN, ignoring case, then
+// by ID so the order never depends on the order they were seen in.
+func sortIngresses(ing []ingress) {
+	if *flagSortLocale != "" {
+		// collate by the rules of the locale, e.g. so accented letters sort
+		// alongside their base letter
+		col := collate.New(language.Make(*flagSortLocale), collate.IgnoreCase)
+		sort.Slice(ing, func(i, j int) bool {
+			if c := col.CompareString(ing[i].String(), ing[j].String()); c != 0 {
+				return c < 0
+			}
+			return ing[i].ID < ing[j].ID
+		})
+		return
+	}
+	sort.Slice(ing, func(i, j int) bool {
+		a, b := strings.ToLower(ing[i].String()), strings.ToLower(ing[j].String())
+		if a != b {
+			return a < b
+		}
+		return ing[i].ID < ing[j].ID
+	})
+}
+
+func ingressListFunc(c kubernetes.Interface, ns string) func(k8sMeta.ListOptions) (runtime.Object, error) {
+	return func(opts k8sMeta.ListOptions) (runtime.Object, error) {
+		return c.NetworkingV1().Ingresses(ns).List(ctx, opts)
+	}
+}
+
+func ingressWatchFunc(c kubernetes.Interface, ns string) func(options k8sMeta.ListOptions) (watch.Interface, error) {
+	return func(options k8sMeta.ListOptions) (watch.Interface, error) {
+		return c.NetworkingV1().Ingresses(ns).Watch(ctx, options)
+	}
+}
+
+// normalizeHost lowercases host, since DNS names are case insensitive and
+// links differing only in case would otherwise be listed twice. It's left
+// alone with -preserve-host-case.
+func normalizeHost(host string) string {
+	if *flagPreserveHostCase {
+		return host
+	}
+	return strings.ToLower(host)
+}
+
+// urlHost returns host as it's written in a URL, an IPv6 address is wrapped
+// in brackets so its colons aren't taken for a port.
+func urlHost(host string) string {
+	if net.ParseIP(host) != nil && strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// validHost returns an error unless host is an IP address or a DNS name which
+// can be linked to, so not a wildcard.
+func validHost(host string) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(host)); len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Codes of a skipReason
+const (
+	skipNoRules     = "no-rules"
+	skipNoHost      = "no-host"
+	skipInvalidHost = "invalid-host"
+	skipNoLB        = "no-load-balancer"
+	skipNoPortName  = "no-backend-port"
+	skipNotOwned    = "not-owned"
+)
+
+// printf logs like fmt.Printf. Entries are built again for /api/live and to
+// compare updates with, those builds pass discardf so they don't repeat the
+// warnings.
+type printf func(format string, a ...interface{}) (int, error)
+
+func discardf(format string, a ...interface{}) (int, error) { return 0, nil }
+
+// skipReason explains why an Ingress isn't listed.
+type skipReason struct {
+	Code   string
+	Detail string
+}
+
+func (r *skipReason) Error() string {
+	return fmt.Sprintf("%s: %s", r.Code, r.Detail)
+}
+
+// buildFQDN returns the link to the first valid rule of ing, or a
+// *skipReason when it has none.
+func buildFQDN(ing *k8sNetworking.Ingress, logf printf) (string, error) {
+	fqdns := buildFQDNs(ing, logf)
+	if len(fqdns) > 0 {
+		return fqdns[0], nil
+	}
+	if len(ing.Spec.Rules) == 0 {
+		return "", &skipReason{Code: skipNoRules, Detail: "the Ingress has no rules"}
+	}
+	for i := range ing.Spec.Rules {
+		if ing.Spec.Rules[i].Host != "" {
+			return "", &skipReason{Code: skipInvalidHost, Detail: fmt.Sprintf("no rule has a valid host, e.g. %q", ing.Spec.Rules[i].Host)}
+		}
+	}
+	return "", &skipReason{Code: skipNoHost, Detail: "no rule has a host and -default-host isn't set"}
+}
+
+// buildFQDNs returns a link to each valid rule of ing, in order. Rules
+// repeating a host only add another link when paths are included and theirs
+// differs. Invalid hosts are skipped, warning through logf.
+func buildFQDNs(ing *k8sNetworking.Ingress, logf printf) []string {
+	spec := ing.Spec
+	schemeOf := hostScheme(ing)
+
+	var fqdns []string
+	seen := make(map[string]bool)
+	for i := range spec.Rules {
+		host := spec.Rules[i].Host
+
+		// Rules without a host match every request, link to them through
+		// the controller's address when we know it.
+		pathOnly := host == "" && *flagDefaultHost != ""
+		if pathOnly {
+			host = *flagDefaultHost
+		}
+		host = normalizeHost(host)
+
+		u, err := url.Parse(fmt.Sprintf("%s://%s", schemeOf(host), urlHost(host)))
+		if err != nil {
+			logf("WARNING: ignoring rule with invalid host %q on %s/%s, err=%v\n", host, ing.Namespace, ing.Name, err)
+			continue
+		}
+		if u.Host == "" || strings.HasPrefix(u.Host, "localhost:") { // ignore rules without a usable host
+			continue
+		}
+		if err := validHost(u.Hostname()); err != nil {
+			logf("WARNING: ignoring rule with invalid host %q on %s/%s, %v\n", host, ing.Namespace, ing.Name, err)
+			continue
+		}
+		// Ingress hosts are a name alone, only -default-host may add a port
+		if u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || (u.Port() != "" && !pathOnly) {
+			logf("WARNING: ignoring rule with invalid host %q on %s/%s, it must be a DNS name or IP address alone\n", host, ing.Namespace, ing.Name)
+			continue
+		}
+		if *flagIncludePaths || pathOnly {
+			u.Path = rulePath(ing, spec.Rules[i])
+		}
+		switch *flagTrailingSlash {
+		case "add":
+			if !strings.HasSuffix(u.Path, "/") {
+				u.Path += "/"
+			}
+		case "strip":
+			u.Path = strings.TrimRight(u.Path, "/")
+		}
+
+		if fqdn := u.String(); !seen[fqdn] {
+			seen[fqdn] = true
+			fqdns = append(fqdns, fqdn)
+		}
+	}
+	return fqdns
+}
+
+// hostScheme returns how hosts of ing are linked to: https when -tls-mode
+// forces it, ing redirects to https or has a TLS entry for the host.
+func hostScheme(ing *k8sNetworking.Ingress) func(host string) string {
+	tlsHosts := make(map[string]bool)
+	for i := range ing.Spec.TLS {
+		for j := range ing.Spec.TLS[i].Hosts {
+			tlsHosts[strings.ToLower(ing.Spec.TLS[i].Hosts[j])] = true
+		}
+	}
+
+	forceTLS := tlsMode() == tlsModeForce
+	sslRedirect := false
+	for _, key := range parseList(*flagSSLRedirectAnnotations) {
+		if annotationBool(ing, key) {
+			sslRedirect = true
+		}
+	}
+
+	return func(host string) string {
+		if forceTLS || sslRedirect || tlsHosts[strings.ToLower(host)] {
+			return "https"
+		}
+		return "http"
+	}
+}
+
+// How the scheme of links is chosen
+const (
+	// tlsModeForce always links over https
+	tlsModeForce = "force"
+
+	// tlsModeAuto links over https when the host has a TLS entry or the
+	// controller is annotated to redirect to https
+	tlsModeAuto = "auto"
+)
+
+// tlsMode returns the -tls-mode in effect. When unset it's auto, unless
+// -force-tls asks for the old default of force.
+func tlsMode() string {
+	if *flagTLSMode != "" {
+		return *flagTLSMode
+	}
+	if *flagForceTLS {
+		return tlsModeForce
+	}
+	return tlsModeAuto
+}
+
+// annotationText returns the annotation key on obj, cut to
+// -max-annotation-length characters so a huge value can't bloat the page.
+// Truncation is warned about through logf.
+func annotationText(obj k8sMeta.ObjectMeta, key string, logf printf) string {
+	value := obj.Annotations[key]
+	max := *flagMaxAnnotationLength
+	if max <= 0 || utf8.RuneCountInString(value) <= max {
+		return value
+	}
+	name := obj.Name
+	if obj.Namespace != "" {
+		name = obj.Namespace + "/" + name
+	}
+	logf("WARNING: truncating %s annotation on %s from %d to %d characters\n", key, name, utf8.RuneCountInString(value), max)
+	return string([]rune(value)[:max]) + "…"
+}
+
+// annotationBool reports if the annotation key on ing is set to a true value.
+func annotationBool(ing *k8sNetworking.Ingress, key string) bool {
+	v, _ := strconv.ParseBool(ing.Annotations[key])
+	return v
+}
+
+// rulePath returns the first path served by rule, as a user would request it.
+func rulePath(ing *k8sNetworking.Ingress, rule k8sNetworking.IngressRule) string {
+	if rule.HTTP == nil || len(rule.HTTP.Paths) == 0 {
+		return ""
+	}
+	path := rule.HTTP.Paths[0].Path
+	for _, key := range strings.Split(*flagRewriteAnnotations, ",") {
+		if _, ok := ing.Annotations[strings.TrimSpace(key)]; ok {
+			// Rewritten paths are regular expressions matched against the
+			// request, so keep only the literal prefix users would visit.
+			if idx := strings.IndexAny(path, `([{*+?|$^\`); idx >= 0 {
+				path = path[:idx]
+			}
+			break
+		}
+	}
+	return path
+}
+
+// buildIngress builds the entry for the first host of ing, warning about
+// annotations and rules it ignores through logf.
+func buildIngress(ing *k8sNetworking.Ingress, logf printf) (*ingress, error) {
+	if *flagRequireLB && len(ing.Status.LoadBalancer.Ingress) == 0 {
+		return nil, &skipReason{Code: skipNoLB, Detail: "the Ingress has no load balancer address yet"}
+	}
+	if *flagBackendPortName != "" && !hasBackendPort(ing, *flagBackendPortName) {
+		return nil, &skipReason{Code: skipNoPortName, Detail: fmt.Sprintf("no path's backend targets a Service port named %q", *flagBackendPortName)}
+	}
+	if *flagOwnerKind != "" && !hasOwnerKind(ing, *flagOwnerKind) {
+		return nil, &skipReason{Code: skipNotOwned, Detail: fmt.Sprintf("no owner reference is a %s", *flagOwnerKind)}
+	}
+	fqdn, err := buildFQDN(ing, logf)
+	if err != nil {
+		return nil, err
+	}
+	return &ingress{
+		Namespace:   ing.Namespace,
+		Name:        ing.Name,
+		FQDN:        fqdn,
+		Class:       ingressClass(ing),
+		TLS:         hasTLS(ing, fqdn),
+		Created:     ing.CreationTimestamp.Time,
+		UpdatedAt:   lastUpdated(ing.ObjectMeta),
+		Description: annotationText(ing.ObjectMeta, annotationDescription, logf),
+		Section:     strings.TrimSpace(annotationText(ing.ObjectMeta, annotationSection, logf)),
+		Slug:        ingressSlug(ing, logf),
+		TTL:         annotationDuration(ing, annotationTTL, logf),
+		NoFollow:    annotationBool(ing, annotationNoFollow),
+		Path:        annotationPath(ing, annotationLinkPath, logf),
+		Links:       annotationLinks(ing, logf),
+		Annotations: shownAnnotations(ing, logf),
+		Rules:       len(ing.Spec.Rules),
+		Paths:       countPaths(ing),
+		apiGroup:    ingressAPIGroup(ing),
+		labels:      ing.Labels,
+		healthPath:  annotationPath(ing, annotationHealthPath, logf),
+		skipProbe:   annotationBool(ing, annotationSkipHealth),
+		routes:      ingressRoutes(ing),
+		Source:      sourceIngress,
+	}, nil
+}
+
+// bulkyAnnotations are set by tools and hold copies of the whole object, so
+// they're never shown
+var bulkyAnnotations = map[string]bool{
+	"kubectl.kubernetes.io/last-applied-configuration": true,
+}
+
+// shownAnnotations returns the annotations of ing to show with its entry,
+// none unless -show-annotations is set. Values are cut to
+// -max-annotation-length like any other annotation shown.
+func shownAnnotations(ing *k8sNetworking.Ingress, logf printf) map[string]string {
+	if !*flagShowAnnotations {
+		return nil
+	}
+	var out map[string]string
+	for key := range ing.Annotations {
+		if bulkyAnnotations[key] {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[key] = annotationText(ing.ObjectMeta, key, logf)
+	}
+	return out
+}
+
+// buildEntries builds the index entries for ing. That's one for its first
+// host, or every host with -all-hosts, under each scheme listed in the
+// schemes annotation or only the computed one when it's absent. What's
+// ignored on the way is warned about through logf.
+func buildEntries(ing *k8sNetworking.Ingress, logf printf) ([]ingress, error) {
+	base, err := buildIngress(ing, logf)
+	if err != nil {
+		return nil, err
+	}
+	fqdns := []string{base.FQDN}
+	if *flagAllHosts {
+		fqdns = buildFQDNs(ing, logf)
+	}
+	schemes := annotationSchemeList(ing, logf)
+
+	var entries []ingress
+	for _, fqdn := range fqdns {
+		entry := *base
+		entry.FQDN = fqdn
+		entry.TLS = hasTLS(ing, fqdn)
+		if len(schemes) == 0 {
+			if strings.HasPrefix(fqdn, "https://") && !entry.TLS {
+				// -tls-mode=force or an ssl-redirect annotation chose https,
+				// the link fails unless the controller has a default cert
+				entry.ForcedInsecure = true
+			}
+			entry.link = templateLink(ing, entry.FQDN, logf)
+			entry.ID = entryID(entry)
+			entries = append(entries, entry)
+			continue
+		}
+		u, err := url.Parse(fqdn)
+		if err != nil {
+			return nil, err
+		}
+		for _, scheme := range schemes {
+			variant := *u
+			variant.Scheme = scheme
+			entry.FQDN = variant.String()
+			entry.link = templateLink(ing, entry.FQDN, logf)
+			entry.ID = entryID(entry)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// warnForcedInsecure logs each of entries linked over https without a TLS
+// entry for its host, unless it already was among before. Resyncs deliver
+// unchanged Ingresses, so they don't repeat the warning.
+func warnForcedInsecure(before, entries []ingress) {
+	for _, entry := range entries {
+		if !entry.ForcedInsecure || wasForcedInsecure(before, entry.FQDN) {
+			continue
+		}
+		fmt.Printf("WARNING: linking %s/%s over https without a TLS entry for its host, fqdn=%s\n", entry.Namespace, entry.Name, entry.FQDN)
+	}
+}
+
+func wasForcedInsecure(entries []ingress, fqdn string) bool {
+	for k := range entries {
+		if entries[k].ForcedInsecure && entries[k].FQDN == fqdn {
+			return true
+		}
+	}
+	return false
+}
+
+// annotationSchemeList returns the schemes requested through the schemes
+// annotation on ing, in order and without duplicates. Anything other than
+// http or https is skipped.
+func annotationSchemeList(ing *k8sNetworking.Ingress, logf printf) []string {
+	v, ok := ing.Annotations[annotationSchemes]
+	if !ok {
+		return nil
+	}
+	var schemes []string
+	seen := make(map[string]bool)
+	for _, scheme := range parseList(v) {
+		scheme = strings.ToLower(scheme)
+		if scheme != "http" && scheme != "https" {
+			logf("WARNING: ignoring invalid scheme %q in %s on %s/%s\n", scheme, annotationSchemes, ing.Namespace, ing.Name)
+			continue
+		}
+		if !seen[scheme] {
+			seen[scheme] = true
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// hasBackendPort reports if any path of ing routes to a Service port named
+// name. Ports given by number never match.
+func hasBackendPort(ing *k8sNetworking.Ingress, name string) bool {
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if svc := path.Backend.Service; svc != nil && svc.Port.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasOwnerKind reports if any owner reference of ing is of kindGroup, a kind
+// or kind.group. Kinds are matched ignoring case, and only a kind.group
+// matches the API group of the owner.
+func hasOwnerKind(ing *k8sNetworking.Ingress, kindGroup string) bool {
+	kind, group := splitKindGroup(kindGroup)
+	for _, ref := range ing.OwnerReferences {
+		if !strings.EqualFold(ref.Kind, kind) {
+			continue
+		}
+		if group == "" {
+			return true
+		}
+		if gv, err := schema.ParseGroupVersion(ref.APIVersion); err == nil && gv.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKindGroup splits kind.group, like Application.argoproj.io, at its first
+// dot. The group is empty when there's none.
+func splitKindGroup(kindGroup string) (kind, group string) {
+	kind, group, _ = strings.Cut(kindGroup, ".")
+	return kind, group
+}
+
+// countPaths returns the number of HTTP paths across every rule of ing.
+func countPaths(ing *k8sNetworking.Ingress) int {
+	n := 0
+	for i := range ing.Spec.Rules {
+		if ing.Spec.Rules[i].HTTP != nil {
+			n += len(ing.Spec.Rules[i].HTTP.Paths)
+		}
+	}
+	return n
+}
+
+// annotationLinks collects the secondary links on ing, keyed by the label
+// following the link annotation prefix. Links which aren't absolute http(s)
+// URLs are skipped.
+func annotationLinks(ing *k8sNetworking.Ingress, logf printf) map[string]string {
+	var links map[string]string
+	for key, value := range ing.Annotations {
+		if !strings.HasPrefix(key, annotationLinkPrefix) {
+			continue
+		}
+		label := strings.TrimPrefix(key, annotationLinkPrefix)
+		u, err := url.Parse(value)
+		if label == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			logf("WARNING: ignoring invalid link %s=%q on %s/%s\n", key, value, ing.Namespace, ing.Name)
+			continue
+		}
+		if links == nil {
+			links = make(map[string]string)
+		}
+		links[label] = u.String()
+	}
+	return links
+}
+
+// annotationPath returns the deep link path annotation from ing, ignoring
+// paths which aren't absolute.
+func annotationPath(ing *k8sNetworking.Ingress, key string, logf printf) string {
+	path, ok := ing.Annotations[key]
+	if !ok {
+		return ""
+	}
+	if !strings.HasPrefix(path, "/") {
+		logf("ignoring %s=%q on %s/%s, it must start with /\n", key, path, ing.Namespace, ing.Name)
+		return ""
+	}
+	return path
+}
+
+// annotationDuration parses the annotation key on ing as a duration, returning
+// zero when it's missing or invalid.
+func annotationDuration(ing *k8sNetworking.Ingress, key string, logf printf) time.Duration {
+	v, ok := ing.Annotations[key]
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		logf("ignoring invalid %s=%q on %s/%s\n", key, v, ing.Namespace, ing.Name)
+		return 0
+	}
+	return d
+}
+
+// ingressClass returns the class of ing, preferring the spec field over the
+// older annotation.
+func ingressClass(ing *k8sNetworking.Ingress) string {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName
+	}
+	return ing.Annotations["kubernetes.io/ingress.class"]
+}
+
+// hasTLS reports if the host of fqdn is covered by a TLS entry on ing.
+func hasTLS(ing *k8sNetworking.Ingress, fqdn string) bool {
+	u, err := url.Parse(fqdn)
+	if err != nil {
+		return false
+	}
+	for i := range ing.Spec.TLS {
+		for _, host := range ing.Spec.TLS[i].Hosts {
+			if strings.EqualFold(host, u.Hostname()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ingress is a smaller model for internal shipping about
+type ingress struct {
+	// ID identifies the entry across snapshots, see entryID
+	ID string `json:"id"`
+
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+
+	// FQDN is an address which the backend is reachable from
+	FQDN string `json:"fqdn"`
+
+	// Class is the IngressClass handling this Ingress, if any
+	Class string `json:"class,omitempty"`
+
+	// TLS is true when the Ingress has a TLS entry for the FQDN's host
+	TLS bool `json:"tls"`
+
+	// ForcedInsecure is true when the FQDN was made https although the
+	// Ingress has no TLS entry for its host, so the link may fail
+	ForcedInsecure bool `json:"forcedInsecure,omitempty"`
+
+	Created time.Time `json:"created"`
+
+	// Conflicts are the other Ingresses, as namespace/name, linking to the
+	// same FQDN
+	Conflicts []string `json:"conflicts,omitempty"`
+
+	// Slug names the entry's short link, /go/<slug>
+	Slug string `json:"slug,omitempty"`
+
+	// Section groups the entry in the grouped theme instead of its namespace
+	Section string `json:"section,omitempty"`
+
+	// UpdatedAt is when the Ingress was last changed
+	UpdatedAt time.Time `json:"updated"`
+
+	// Description is free text from the description annotation
+	Description string `json:"description,omitempty"`
+
+	// Annotations of the Ingress, kept with -show-annotations
+	Annotations map[string]string `json:"-"`
+
+	// DataAttrs are data-* attributes rendered onto the entry's element
+	DataAttrs template.HTMLAttr `json:"-"`
+
+	// Status is the reachability of the FQDN: up, down or unknown
+	Status string `json:"status,omitempty"`
+
+	// Disabled entries are shown without linking to the Ingress
+	Disabled bool `json:"-"`
+
+	// Anchor is the id of the entry within a page
+	Anchor string `json:"-"`
+
+	// Source is where the entry came from: an Ingress, or a ConfigMap of
+	// static links
+	Source string `json:"source"`
+
+	// MergedFQDNs are the FQDNs of other Ingresses folded into this entry by
+	// -collision-policy=merge
+	MergedFQDNs []string `json:"mergedFqdns,omitempty"`
+
+	// Path is appended to the FQDN when linking to the entry
+	Path string `json:"path,omitempty"`
+
+	// Links are secondary links shown with the entry, keyed by label
+	Links map[string]string `json:"links,omitempty"`
+
+	// Rules and Paths count how many rules, and paths across them, the
+	// Ingress has
+	Rules int `json:"rules"`
+	Paths int `json:"paths"`
+
+	// NoFollow asks search engines not to follow the link
+	NoFollow bool `json:"nofollow,omitempty"`
+
+	// TTL is how long the entry is kept without hearing about its Ingress,
+	// forever when zero
+	TTL      time.Duration `json:"-"`
+	lastSeen time.Time
+
+	// apiGroup is the API group the Ingress was read from
+	apiGroup string
+
+	// labels of the Ingress, for -host-filters
+	labels map[string]string
+
+	// healthPath is appended to the FQDN when probing its reachability
+	healthPath string
+
+	// skipProbe excludes the entry from reachability checks
+	skipProbe bool
+
+	// link replaces the FQDN and Path as the href when -link-template is set
+	link string
+
+	// routes are the paths of every rule, for the hosts theme
+	routes []route
+}
+
+// DescriptionHTML returns the description for rendering, which is escaped
+// unless -trusted-descriptions is set.
+func (ing ingress) DescriptionHTML() template.HTML {
+	if *flagTrustedDescriptions {
+		return template.HTML(ing.Description)
+	}
+	return template.HTML(template.HTMLEscapeString(ing.Description))
+}
+
+// annotationsOpenMax is how many annotations are shown expanded, more are
+// collapsed until clicked
+const annotationsOpenMax = 5
+
+// AnnotationsOpen is true when the annotations are few enough to show
+// expanded.
+func (ing ingress) AnnotationsOpen() bool {
+	return len(ing.Annotations) <= annotationsOpenMax
+}
+
+// probeURL returns the URL checked for the reachability of ing, its FQDN with
+// the health path appended.
+func (ing ingress) probeURL() string {
+	if ing.healthPath == "" {
+		return ing.FQDN
+	}
+	return strings.TrimSuffix(ing.FQDN, "/") + ing.healthPath
+}
+
+// Href returns the link for the entry, the FQDN plus any deep link path.
+func (ing ingress) Href() string {
+	if ing.link != "" {
+		return ing.link
+	}
+	if ing.Path == "" {
+		return ing.FQDN
+	}
+	return strings.TrimSuffix(ing.FQDN, "/") + ing.Path
+}
+
+// Rel returns the rel attribute value for the entry's link.
+func (ing ingress) Rel() string {
+	var rels []string
+	if ing.NoFollow {
+		rels = append(rels, "nofollow")
+	}
+	return strings.Join(rels, " ")
+}
+
+// entryID derives a stable ID for ing from where it came from, its namespace,
+// name, FQDN and path, so it's the same in every snapshot and across restarts.
+// With -identity-includes-class the class is included too, like in key.
+func entryID(ing ingress) string {
+	fields := []string{ing.Source, ing.Namespace, ing.Name, ing.FQDN, ing.Path}
+	if *flagIdentityIncludesClass {
+		fields = append(fields, ing.Class)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// key identifies the Ingress object an entry was built from. With
+// -identity-includes-class Ingresses of different classes sharing a namespace
+// and name are told apart, e.g. "apps/web#nginx".
+func (ing ingress) key() string {
+	if *flagIdentityIncludesClass {
+		return ing.objectKey() + "#" + ing.Class
+	}
+	return ing.objectKey()
+}
+
+// objectKey is the informer store key of the Ingress an entry was built from.
+func (ing ingress) objectKey() string {
+	return ing.Namespace + "/" + ing.Name
+}
+
+func (ing ingress) String() string {
+	return fmt.Sprintf("Ingress: namespace=%s, name=%s, fqdn=%s", ing.Namespace, ing.Name, ing.FQDN)
+}
+
+type ingresses struct {
+	// current set of Ingress objects
+	active []ingress
+	mu     sync.Mutex
+}
+
+func (i *ingresses) upsert(entries []ingress) []ingress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// An Ingress may have several entries, replace all of them with the
+	// latest version.
+	var next []ingress
+	for k := range i.active {
+		if len(entries) > 0 && sameSource(i.active[k], entries[0]) {
+			continue
+		}
+		next = append(next, i.active[k])
+	}
+	for _, ing := range entries {
+		ing.lastSeen = now()
+		next = append(next, ing)
+	}
+	i.active = next
+
+	return i.snapshot()
+}
+
+func (i *ingresses) delete(ing ingress) []ingress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var next []ingress
+	for k := range i.active {
+		if sameSource(i.active[k], ing) {
+			continue
+		}
+		next = append(next, i.active[k])
+	}
+	i.active = next
+
+	return i.snapshot()
+}
+
+// retain removes entries in namespace ns read from the API group whose
+// object key isn't kept. A copy of what's left is returned.
+func (i *ingresses) retain(ns, group string, keep func(key string) bool) []ingress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var next []ingress
+	for k := range i.active {
+		if i.active[k].Namespace == ns && i.active[k].apiGroup == group && !keep(i.active[k].objectKey()) {
+			continue
+		}
+		next = append(next, i.active[k])
+	}
+	i.active = next
+
+	return i.snapshot()
+}
+
+// replaceStatic replaces every static link with entries, returning a copy of
+// what's left.
+func (i *ingresses) replaceStatic(entries []ingress) []ingress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var next []ingress
+	for k := range i.active {
+		if i.active[k].Source == sourceConfigMap {
+			continue
+		}
+		next = append(next, i.active[k])
+	}
+	for _, ing := range entries {
+		ing.lastSeen = now()
+		next = append(next, ing)
+	}
+	i.active = next
+
+	return i.snapshot()
+}
+
+// removeNamespace removes every Ingress entry in namespace ns, returning a
+// copy of what's left.
+func (i *ingresses) removeNamespace(ns string) []ingress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var next []ingress
+	for k := range i.active {
+		if i.active[k].Namespace == ns && i.active[k].Source == sourceIngress {
+			continue
+		}
+		next = append(next, i.active[k])
+	}
+	i.active = next
+
+	return i.snapshot()
+}
+
+// expire removes entries with a TTL which haven't been seen since before t
+// minus their TTL. The removed entries are returned along with a copy of
+// what's left.
+func (i *ingresses) expire(t time.Time) (removed, current []ingress) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var next []ingress
+	for k := range i.active {
+		ing := i.active[k]
+		if ing.TTL > 0 && t.Sub(ing.lastSeen) > ing.TTL {
+			removed = append(removed, ing)
+			continue
+		}
+		next = append(next, ing)
+	}
+	i.active = next
+
+	return removed, i.snapshot()
+}
+
+// snapshot returns a copy of the active entries. An Ingress read from several
+// API groups, e.g. while migrating from extensions to networking.k8s.io, is
+// only listed from the highest ranked one. Static links aren't read from an
+// API group, so they're always listed.
+func (i *ingresses) snapshot() []ingress {
+	preferred := make(map[string]string)
+	for k := range i.active {
+		if i.active[k].Source != sourceIngress {
+			continue
+		}
+		key, group := i.active[k].key(), i.active[k].apiGroup
+		if current, ok := preferred[key]; !ok || apiGroupRank[group] > apiGroupRank[current] {
+			preferred[key] = group
+		}
+	}
+	out := make([]ingress, 0, len(i.active))
+	for k := range i.active {
+		if i.active[k].Source != sourceIngress || i.active[k].apiGroup == preferred[i.active[k].key()] {
+			out = append(out, i.active[k])
+		}
+	}
+	markConflicts(out)
+	out = liveConfig.apply(out)
+	switch *flagCollisionPolicy {
+	case collisionMerge:
+		return mergeCollisions(out)
+	case collisionLastWins:
+		return lastWins(out)
+	}
+	return out
+}
+
+// current returns a copy of the entries, as sent after each change.
+func (i *ingresses) current() []ingress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.snapshot()
+}
+
+// How entries of different Ingresses with the same name or FQDN are listed
+const (
+	// collisionSeparate lists each of them
+	collisionSeparate = "separate"
+
+	// collisionMerge lists the first, with the FQDNs of the others
+	collisionMerge = "merge"
+
+	// collisionLastWins lists the one changed most recently
+	collisionLastWins = "last-wins"
+)
+
+// collides reports if a and b are entries of different Ingresses sharing a
+// name or FQDN.
+func collides(a, b ingress) bool {
+	return a.key() != b.key() && (a.Name == b.Name || a.FQDN == b.FQDN)
+}
+
+// lastWins drops each entry colliding with an entry of an Ingress changed
+// more recently. Every entry stays in the accumulator, so when the winner is
+// deleted the next most recent is listed again.
+func lastWins(ings []ingress) []ingress {
+	order := make([]int, len(ings))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return changedAfter(ings[order[a]], ings[order[b]])
+	})
+
+	kept := make([]bool, len(ings))
+	var winners []ingress
+	for _, k := range order {
+		if firstCollision(winners, ings[k]) >= 0 {
+			continue
+		}
+		kept[k] = true
+		winners = append(winners, ings[k])
+	}
+
+	out := make([]ingress, 0, len(winners))
+	for k := range ings {
+		if kept[k] {
+			out = append(out, ings[k])
+		}
+	}
+	return out
+}
+
+// changedAfter reports if a's Ingress changed more recently than b's. Ties
+// are broken by creation and then by key, so the winner of a collision never
+// depends on the order the Ingresses were seen in, e.g. on each resync.
+func changedAfter(a, b ingress) bool {
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	return a.key() < b.key()
+}
+
+// mergeCollisions folds each entry into the first earlier one it collides
+// with, adding its FQDN to that entry's MergedFQDNs.
+func mergeCollisions(ings []ingress) []ingress {
+	out := make([]ingress, 0, len(ings))
+	for _, ing := range ings {
+		k := firstCollision(out, ing)
+		if k < 0 {
+			out = append(out, ing)
+			continue
+		}
+		if ing.FQDN != out[k].FQDN && !containsString(out[k].MergedFQDNs, ing.FQDN) {
+			// copy rather than append to a slice shared with the accumulator
+			merged := make([]string, 0, len(out[k].MergedFQDNs)+1)
+			out[k].MergedFQDNs = append(append(merged, out[k].MergedFQDNs...), ing.FQDN)
+		}
+	}
+	return out
+}
+
+// firstCollision returns the index of the first of ings which collides with
+// ing, or -1.
+func firstCollision(ings []ingress, ing ingress) int {
+	for k := range ings {
+		if collides(ings[k], ing) {
+			return k
+		}
+	}
+	return -1
+}
+
+// sameSource reports if a and b are entries of the same Ingress read from
+// the same API group.
+func sameSource(a, b ingress) bool {
+	return a.Source == b.Source && a.key() == b.key() && a.apiGroup == b.apiGroup
+}
+
+// sweepExpired periodically removes entries which outlived their TTL, it
+// never returns.
+func sweepExpired(accum *ingresses, respChan chan []ingress) {
+	for {
+		time.Sleep(ttlSweepInterval)
+
+		removed, current := accum.expire(now())
+		if len(removed) == 0 {
+			continue
+		}
+		sendSnapshot(respChan, current)
+		for _, ing := range removed {
+			fmt.Printf("expired %s, watching %d Ingress objects\n", ing.String(), len(current))
+		}
+	}
+}
+
+// sendSnapshot queues ings for rendering without blocking the informer. When
+// the queue is full the oldest pending snapshot is dropped, as every snapshot
+// is a complete copy of the index only the latest matters.
+func sendSnapshot(respChan chan []ingress, ings []ingress) {
+	for {
+		select {
+		case respChan <- ings:
+			return
+		default:
+		}
+		select {
+		case <-respChan:
+			snapshotDrops.inc()
+		default:
+		}
+	}
+}
+
+// newIngressInformer builds an informer of the Ingresses in ns, which
+// re-delivers every object each resync, or never when resync is 0.
+func newIngressInformer(kubeClient kubernetes.Interface, ns string, resync time.Duration, handler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	watch := &cache.ListWatch{
+		ListFunc:  ingressListFunc(kubeClient, ns),
+		WatchFunc: ingressWatchFunc(kubeClient, ns),
+	}
+	return cache.NewInformer(watch, &k8sNetworking.Ingress{}, resync, handler)
+}
+
+// ingressEventHandler keeps accum up to date with the events of the Ingress
+// informers, sending a snapshot on respChan after each change.
+func ingressEventHandler(accum *ingresses, respChan chan []ingress) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			addIng, ok := obj.(*k8sNetworking.Ingress)
-			if ok {
-				ing, err := buildIngress(addIng)
-				if err == nil {
-					current := accum.upsert(*ing)
-					respChan <- current
-					fmt.Printf("added %s, watching %d Ingress objects\n", ing.String(), len(current))
+			if ok && informers.seen(addIng.Namespace) {
+				entries, err := buildEntries(addIng, fmt.Printf)
+				if err != nil {
+					fmt.Printf("skipping %s/%s, %v\n", addIng.Namespace, addIng.Name, err)
+					return
 				}
+				warnForcedInsecure(nil, entries)
+				current := accum.upsert(entries)
+				sendSnapshot(respChan, current)
+				fmt.Printf("added %s, watching %d Ingress objects\n", entries[0].String(), len(current))
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
+			// A delete missed while the watch was down arrives as a
+			// tombstone holding the last state we knew of.
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
 			delIng, ok := obj.(*k8sNetworking.Ingress)
-			if ok {
-				ing, err := buildIngress(delIng)
-				if err == nil {
-					current := accum.delete(*ing)
-					respChan <- current
-					fmt.Printf("deleted %s, watching %d Ingress objects\n", ing.String(), len(current))
-				}
+			if ok && informers.seen(delIng.Namespace) {
+				// The object may not build any longer, e.g. its rules
+				// were removed first, so its entries are found by name.
+				key := delIng.Namespace + "/" + delIng.Name
+				current := accum.retain(delIng.Namespace, ingressAPIGroup(delIng), func(k string) bool { return k != key })
+				sendSnapshot(respChan, current)
+				fmt.Printf("deleted Ingress: namespace=%s, name=%s, watching %d Ingress objects\n", delIng.Namespace, delIng.Name, len(current))
 			}
 		},
-		UpdateFunc: func(_, cur interface{}) {
+		UpdateFunc: func(old, cur interface{}) {
 			upIng, ok := cur.(*k8sNetworking.Ingress)
-			if ok {
-				ing, err := buildIngress(upIng)
-				if err == nil {
-					current := accum.upsert(*ing)
-					respChan <- current
-					fmt.Printf("updated %s, watching %d Ingress objects\n", ing.String(), len(current))
+			if !ok || !informers.seen(upIng.Namespace) {
+				return
+			}
+			var before []ingress
+			if oldIng, ok := old.(*k8sNetworking.Ingress); ok {
+				before, _ = buildEntries(oldIng, discardf)
+			}
+			entries, err := buildEntries(upIng, fmt.Printf)
+			if err == nil {
+				warnForcedInsecure(before, entries)
+				if len(before) > 0 && before[0].key() != entries[0].key() {
+					// the identity changed, don't leave the old entry behind
+					accum.delete(before[0])
 				}
+				current := accum.upsert(entries)
+				sendSnapshot(respChan, current)
+				fmt.Printf("updated %s, watching %d Ingress objects\n", entries[0].String(), len(current))
+				return
+			}
+			// The new object no longer qualifies, drop it if the old one did.
+			if len(before) > 0 {
+				current := accum.delete(before[0])
+				sendSnapshot(respChan, current)
+				fmt.Printf("removed %s, watching %d Ingress objects\n", before[0].String(), len(current))
 			}
 		},
 	}
+}
+
+func watchIngresses(kubeClient kubernetes.Interface, namespaces []string, respChan chan []ingress) {
+	// Internal accumulator, a copy is sent back each time
+	accum := &ingresses{}
+	go sweepExpired(accum, respChan)
+	go rebuildOnChange(liveConfig, accum, respChan)
 
-	for i := range namespaces {
-		watch := &cache.ListWatch{
-			ListFunc:  ingressListFunc(kubeClient, namespaces[i]),
-			WatchFunc: ingressWatchFunc(kubeClient, namespaces[i]),
+	ingEventHandler := ingressEventHandler(accum, respChan)
+
+	// newInformer builds the Ingress informer of ns, which isn't running
+	newInformer := func(ns string) (cache.Store, cache.Controller, chan struct{}) {
+		store, controller := newIngressInformer(kubeClient, ns, *flagResyncInterval, ingEventHandler)
+		stop := make(chan struct{}) // TODO(adam): pass doneChan through to here
+		return store, controller, stop
+	}
+	// stops of the extensions informer in each namespace
+	var (
+		extensionStops = make(map[string]chan struct{})
+		extensionsMu   sync.Mutex
+	)
+	startNamespace := func(ns string) {
+		if err := checkIngressList(kubeClient, ns); err != nil {
+			fmt.Printf("ERROR: skipping namespace %s, err=%v\n", ns, err)
+			informers.skip(ns, err.Error())
+			return
+		}
+		store, controller, stop := newInformer(ns)
+		informers.add(ns, controller.HasSynced, store, stop)
+		go controller.Run(stop)
+		if *flagExtensionsIngresses {
+			stop := make(chan struct{})
+			extensionsMu.Lock()
+			extensionStops[ns] = stop
+			extensionsMu.Unlock()
+			watchExtensionsIngresses(kubeClient, ns, ingEventHandler, stop)
+		}
+	}
+	stopNamespace := func(ns string) {
+		if !informers.remove(ns) {
+			return
+		}
+		extensionsMu.Lock()
+		if stop, ok := extensionStops[ns]; ok {
+			close(stop)
+			delete(extensionStops, ns)
+		}
+		extensionsMu.Unlock()
+
+		current := accum.removeNamespace(ns)
+		sendSnapshot(respChan, current)
+		fmt.Printf("stopped watching namespace %s, watching %d Ingress objects\n", ns, len(current))
+	}
+
+	if *flagStaticLinks != "" {
+		watchStaticLinks(kubeClient, *flagStaticLinks, accum, respChan)
+	}
+
+	if *flagNamespaceSelector != "" {
+		hasSynced := watchSelectedNamespaces(kubeClient, *flagNamespaceSelector, startNamespace, stopNamespace)
+		go func() {
+			// every namespace listed has been started once it's synced
+			cache.WaitForCacheSync(nil, hasSynced)
+			informers.markStarted()
+		}()
+	} else {
+		for i := range namespaces {
+			startNamespace(namespaces[i])
+		}
+		informers.markStarted()
+	}
+
+	// Without resyncs a quiet namespace is indistinguishable from a wedged
+	// informer, so the watchdog only runs alongside them.
+	if *flagWatchdogTimeout > 0 && *flagResyncInterval > 0 {
+		restart := func(ns string) {
+			var (
+				store      cache.Store
+				controller cache.Controller
+				stop       chan struct{}
+			)
+			replaced := informers.replace(ns, func() (func() bool, cache.Store, chan struct{}) {
+				store, controller, stop = newInformer(ns)
+				return controller.HasSynced, store, stop
+			})
+			if !replaced {
+				return // stopped watching ns meanwhile
+			}
+			go controller.Run(stop)
+			go func() {
+				// The new informer won't see deletes we missed, so once
+				// it's synced drop anything it doesn't know about.
+				if !cache.WaitForCacheSync(stop, controller.HasSynced) {
+					return
+				}
+				current := accum.retain(ns, apiGroupNetworking, func(key string) bool {
+					_, exists, _ := store.GetByKey(key)
+					return exists
+				})
+				sendSnapshot(respChan, current)
+			}()
 		}
-		_, controller := cache.NewInformer(watch, &k8sNetworking.Ingress{}, resyncInterval, ingEventHandler)
-		go controller.Run(nil) // TODO(adam): pass doneChan through to here
+		go watchdog(informers, *flagWatchdogTimeout, restart)
 	}
 }
@@ -0,0 +1,1372 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	k8sCore "k8s.io/api/core/v1"
+	k8sNetworking "k8s.io/api/networking/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// setFlag sets the flag value at p for the rest of the test.
+func setFlag[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// captureOutput returns what f prints to stdout.
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// writeTempFile writes content to a file named name in a directory removed
+// after the test, returning its path.
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testIngress returns an Ingress namespace/name with a rule for each host.
+func testIngress(namespace, name string, hosts ...string) *k8sNetworking.Ingress {
+	ing := &k8sNetworking.Ingress{
+		ObjectMeta: k8sMeta.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			CreationTimestamp: k8sMeta.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
+	}
+	for _, host := range hosts {
+		ing.Spec.Rules = append(ing.Spec.Rules, k8sNetworking.IngressRule{Host: host})
+	}
+	return ing
+}
+
+// testEntries builds the entries of ing, failing the test when it's skipped.
+func testEntries(t *testing.T, ing *k8sNetworking.Ingress) []ingress {
+	t.Helper()
+	entries, err := buildEntries(ing, fmt.Printf)
+	if err != nil {
+		t.Fatalf("building %s/%s: %v", ing.Namespace, ing.Name, err)
+	}
+	return entries
+}
+
+// watchTestNamespace has the event handlers accept events from ns for the
+// rest of the test.
+func watchTestNamespace(t *testing.T, ns string) {
+	t.Helper()
+	informers.add(ns, func() bool { return true }, cache.NewStore(cache.MetaNamespaceKeyFunc), make(chan struct{}))
+	t.Cleanup(func() { informers.remove(ns) })
+}
+
+// latestSnapshot returns the last snapshot queued on respChan, nil when none
+// was.
+func latestSnapshot(respChan chan []ingress) []ingress {
+	var out []ingress
+	for {
+		select {
+		case out = <-respChan:
+		default:
+			return out
+		}
+	}
+}
+
+// startWatching runs watchIngresses against client for the rest of the test,
+// returning the channel snapshots are sent on.
+func startWatching(t *testing.T, client kubernetes.Interface, namespaces ...string) chan []ingress {
+	t.Helper()
+	setFlag(t, flagWatchdogTimeout, 0)
+	respChan := make(chan []ingress, 10)
+	watchIngresses(client, namespaces, respChan)
+	t.Cleanup(func() {
+		for _, ns := range namespaces {
+			informers.remove(ns)
+		}
+	})
+	return respChan
+}
+
+// waitForSnapshot returns the first snapshot on respChan which ok accepts,
+// failing the test when none arrives in time.
+func waitForSnapshot(t *testing.T, respChan chan []ingress, ok func(ings []ingress) bool) []ingress {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ings := <-respChan:
+			if ok(ings) {
+				return ings
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a snapshot")
+			return nil
+		}
+	}
+}
+
+func TestRewritePaths(t *testing.T) {
+	setFlag(t, flagIncludePaths, true)
+
+	for _, tc := range []struct {
+		path        string
+		annotations map[string]string
+		fqdn        string
+	}{
+		{path: "/app", fqdn: "http://app.example.com/app"},
+		{path: "/app(/|$)(.*)", fqdn: "http://app.example.com/app%28/%7C$%29%28.%2A%29"},
+		{path: "/app(/|$)(.*)", annotations: map[string]string{"nginx.ingress.kubernetes.io/rewrite-target": "/$2"}, fqdn: "http://app.example.com/app"},
+		{path: "/api/v[0-9]+", annotations: map[string]string{"nginx.ingress.kubernetes.io/rewrite-target": "/"}, fqdn: "http://app.example.com/api/v"},
+		{path: "/app", annotations: map[string]string{"nginx.ingress.kubernetes.io/rewrite-target": "/"}, fqdn: "http://app.example.com/app"},
+	} {
+		ing := testIngress("apps", "app", "app.example.com")
+		ing.Annotations = tc.annotations
+		ing.Spec.Rules[0].HTTP = &k8sNetworking.HTTPIngressRuleValue{
+			Paths: []k8sNetworking.HTTPIngressPath{{Path: tc.path}},
+		}
+		fqdn, err := buildFQDN(ing, fmt.Printf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fqdn != tc.fqdn {
+			t.Errorf("path %q with annotations %v: got %s, expected %s", tc.path, tc.annotations, fqdn, tc.fqdn)
+		}
+	}
+}
+
+func TestUpdateTransitions(t *testing.T) {
+	watchTestNamespace(t, "apps")
+
+	qualifying := testIngress("apps", "web", "web.example.com")
+	disqualified := testIngress("apps", "web") // no rules
+
+	for _, tc := range []struct {
+		name     string
+		old, cur *k8sNetworking.Ingress
+		fqdns    []string
+	}{
+		{name: "qualify to disqualify", old: qualifying, cur: disqualified, fqdns: nil},
+		{name: "disqualify to qualify", old: disqualified, cur: qualifying, fqdns: []string{"http://web.example.com"}},
+		{name: "qualify to qualify", old: qualifying, cur: testIngress("apps", "web", "www.example.com"), fqdns: []string{"http://www.example.com"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			accum := &ingresses{}
+			respChan := make(chan []ingress, 10)
+			handler := ingressEventHandler(accum, respChan)
+			captureOutput(t, func() {
+				handler.AddFunc(tc.old)
+				handler.UpdateFunc(tc.old, tc.cur)
+			})
+
+			var fqdns []string
+			for _, ing := range accum.current() {
+				fqdns = append(fqdns, ing.FQDN)
+			}
+			if !reflect.DeepEqual(fqdns, tc.fqdns) {
+				t.Errorf("got FQDNs %v, expected %v", fqdns, tc.fqdns)
+			}
+			if got := latestSnapshot(respChan); len(got) != len(tc.fqdns) {
+				t.Errorf("last snapshot has %d entries, expected %d", len(got), len(tc.fqdns))
+			}
+		})
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	withPath := func(path string) *k8sNetworking.Ingress {
+		ing := testIngress("apps", "app", "app.example.com")
+		ing.Spec.Rules[0].HTTP = &k8sNetworking.HTTPIngressRuleValue{
+			Paths: []k8sNetworking.HTTPIngressPath{{Path: path}},
+		}
+		return ing
+	}
+
+	for _, tc := range []struct {
+		mode  string
+		paths bool
+		ing   *k8sNetworking.Ingress
+		fqdn  string
+	}{
+		{mode: "preserve", ing: withPath("/app/"), fqdn: "http://app.example.com"},
+		{mode: "preserve", paths: true, ing: withPath("/app/"), fqdn: "http://app.example.com/app/"},
+		{mode: "preserve", paths: true, ing: withPath("/app"), fqdn: "http://app.example.com/app"},
+		{mode: "add", ing: withPath("/app"), fqdn: "http://app.example.com/"},
+		{mode: "add", paths: true, ing: withPath("/app"), fqdn: "http://app.example.com/app/"},
+		{mode: "add", paths: true, ing: withPath("/app/"), fqdn: "http://app.example.com/app/"},
+		{mode: "strip", ing: withPath("/app/"), fqdn: "http://app.example.com"},
+		{mode: "strip", paths: true, ing: withPath("/app/"), fqdn: "http://app.example.com/app"},
+		{mode: "strip", paths: true, ing: withPath("/"), fqdn: "http://app.example.com"},
+	} {
+		setFlag(t, flagTrailingSlash, tc.mode)
+		setFlag(t, flagIncludePaths, tc.paths)
+
+		fqdn, err := buildFQDN(tc.ing, fmt.Printf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fqdn != tc.fqdn {
+			t.Errorf("-trailing-slash=%s -include-paths=%v with path %s: got %s, expected %s", tc.mode, tc.paths, tc.ing.Spec.Rules[0].HTTP.Paths[0].Path, fqdn, tc.fqdn)
+		}
+	}
+}
+
+func TestSSLRedirectScheme(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		mode        string
+		annotations map[string]string
+		tls         bool
+		fqdn        string
+	}{
+		{name: "plain", fqdn: "http://app.example.com"},
+		{name: "tls", tls: true, fqdn: "https://app.example.com"},
+		{name: "nginx ssl-redirect", annotations: map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true"}, fqdn: "https://app.example.com"},
+		{name: "nginx force-ssl-redirect", annotations: map[string]string{"nginx.ingress.kubernetes.io/force-ssl-redirect": "true"}, fqdn: "https://app.example.com"},
+		{name: "traefik", annotations: map[string]string{"traefik.ingress.kubernetes.io/router.tls": "true"}, fqdn: "https://app.example.com"},
+		{name: "redirect off", annotations: map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "false"}, fqdn: "http://app.example.com"},
+		{name: "unknown annotation", annotations: map[string]string{"example.com/ssl-redirect": "true"}, fqdn: "http://app.example.com"},
+		{name: "forced", mode: tlsModeForce, fqdn: "https://app.example.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagTLSMode, tc.mode)
+
+			ing := testIngress("apps", "app", "app.example.com")
+			ing.Annotations = tc.annotations
+			if tc.tls {
+				ing.Spec.TLS = []k8sNetworking.IngressTLS{{Hosts: []string{"app.example.com"}}}
+			}
+			fqdn, err := buildFQDN(ing, fmt.Printf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fqdn != tc.fqdn {
+				t.Errorf("got %s, expected %s", fqdn, tc.fqdn)
+			}
+		})
+	}
+}
+
+func TestSendSnapshotDrops(t *testing.T) {
+	respChan := make(chan []ingress, 2)
+	before := atomic.LoadUint64(&snapshotDrops.value)
+
+	snapshot := func(n int) []ingress { return make([]ingress, n) }
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 1; n <= 5; n++ {
+			sendSnapshot(respChan, snapshot(n))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sendSnapshot blocked on a full channel")
+	}
+
+	if drops := atomic.LoadUint64(&snapshotDrops.value) - before; drops != 3 {
+		t.Errorf("got %d drops, expected 3", drops)
+	}
+	// the oldest snapshots are dropped, the latest is always kept
+	for _, n := range []int{4, 5} {
+		if got := <-respChan; len(got) != n {
+			t.Errorf("got snapshot %d, expected %d", len(got), n)
+		}
+	}
+
+	_, body := get(t, http.HandlerFunc(serveMetrics), "/metrics")
+	if want := fmt.Sprintf("kube_ingress_index_snapshot_drops_total %d\n", atomic.LoadUint64(&snapshotDrops.value)); !strings.Contains(body, want) {
+		t.Errorf("/metrics is missing %q", want)
+	}
+}
+
+func TestPathOnlyIngress(t *testing.T) {
+	rule := func(host, path string) k8sNetworking.IngressRule {
+		return k8sNetworking.IngressRule{
+			Host: host,
+			IngressRuleValue: k8sNetworking.IngressRuleValue{HTTP: &k8sNetworking.HTTPIngressRuleValue{
+				Paths: []k8sNetworking.HTTPIngressPath{{Path: path}},
+			}},
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		defaultHost string
+		rules       []k8sNetworking.IngressRule
+		fqdns       []string
+		skip        string
+	}{
+		{name: "no default host", rules: []k8sNetworking.IngressRule{rule("", "/grafana")}, skip: skipNoHost},
+		{name: "default host", defaultHost: "lb.example.com", rules: []k8sNetworking.IngressRule{rule("", "/grafana")}, fqdns: []string{"http://lb.example.com/grafana"}},
+		{name: "default host with port", defaultHost: "lb.example.com:8443", rules: []k8sNetworking.IngressRule{rule("", "/grafana")}, fqdns: []string{"http://lb.example.com:8443/grafana"}},
+		{name: "host and path-only", defaultHost: "lb.example.com", rules: []k8sNetworking.IngressRule{rule("grafana.example.com", "/"), rule("", "/grafana")}, fqdns: []string{"http://grafana.example.com", "http://lb.example.com/grafana"}},
+		{name: "host without default", rules: []k8sNetworking.IngressRule{rule("", "/grafana"), rule("grafana.example.com", "/")}, fqdns: []string{"http://grafana.example.com"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagDefaultHost, tc.defaultHost)
+			setFlag(t, flagAllHosts, true)
+
+			ing := testIngress("apps", "grafana")
+			ing.Spec.Rules = tc.rules
+			entries, err := buildEntries(ing, fmt.Printf)
+			if tc.skip != "" {
+				var reason *skipReason
+				if !errors.As(err, &reason) || reason.Code != tc.skip {
+					t.Fatalf("got error %v, expected %s", err, tc.skip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fqdns []string
+			for _, ing := range entries {
+				fqdns = append(fqdns, ing.FQDN)
+			}
+			if !reflect.DeepEqual(fqdns, tc.fqdns) {
+				t.Errorf("got %v, expected %v", fqdns, tc.fqdns)
+			}
+		})
+	}
+}
+
+func TestUpdateIdentityChange(t *testing.T) {
+	watchTestNamespace(t, "apps")
+	setFlag(t, flagIdentityIncludesClass, true)
+
+	withClass := func(name, class string) *k8sNetworking.Ingress {
+		ing := testIngress("apps", name, name+".example.com")
+		ing.Spec.IngressClassName = &class
+		return ing
+	}
+
+	for _, tc := range []struct {
+		name     string
+		old, cur *k8sNetworking.Ingress
+		keys     []string
+	}{
+		{name: "same identity", old: withClass("web", "nginx"), cur: withClass("web", "nginx"), keys: []string{"apps/web#nginx"}},
+		{name: "class changed", old: withClass("web", "nginx"), cur: withClass("web", "traefik"), keys: []string{"apps/web#traefik"}},
+		{name: "name changed", old: withClass("web", "nginx"), cur: withClass("www", "nginx"), keys: []string{"apps/www#nginx"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			accum := &ingresses{}
+			handler := ingressEventHandler(accum, make(chan []ingress, 10))
+			captureOutput(t, func() {
+				handler.AddFunc(tc.old)
+				handler.UpdateFunc(tc.old, tc.cur)
+			})
+
+			var keys []string
+			for _, ing := range accum.current() {
+				keys = append(keys, ing.key())
+			}
+			if !reflect.DeepEqual(keys, tc.keys) {
+				t.Errorf("got %v, expected %v", keys, tc.keys)
+			}
+		})
+	}
+}
+
+func TestExpireTTL(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	setFlag(t, &now, func() time.Time { return clock })
+
+	transient := testIngress("apps", "preview", "preview.example.com")
+	transient.Annotations = map[string]string{annotationTTL: "1m"}
+	permanent := testIngress("apps", "web", "web.example.com")
+
+	accum := &ingresses{}
+	accum.upsert(testEntries(t, transient))
+	accum.upsert(testEntries(t, permanent))
+
+	for _, tc := range []struct {
+		advance time.Duration
+		resync  bool // the informer delivers transient again first
+		removed int
+		current int
+	}{
+		{advance: 30 * time.Second, removed: 0, current: 2},
+		{advance: 45 * time.Second, resync: true, removed: 0, current: 2}, // 75s since added, 0s since seen
+		{advance: 45 * time.Second, removed: 0, current: 2},
+		{advance: 30 * time.Second, removed: 1, current: 1},
+		{advance: time.Hour, removed: 0, current: 1},
+	} {
+		clock = clock.Add(tc.advance)
+		if tc.resync {
+			accum.upsert(testEntries(t, transient))
+		}
+		removed, current := accum.expire(now())
+		if len(removed) != tc.removed || len(current) != tc.current {
+			t.Fatalf("at %s: removed %d leaving %d, expected %d leaving %d", clock.Format("15:04:05"), len(removed), len(current), tc.removed, tc.current)
+		}
+		if len(removed) > 0 && removed[0].Name != "preview" {
+			t.Errorf("removed %s, expected apps/preview", removed[0].String())
+		}
+	}
+}
+
+func TestResyncInterval(t *testing.T) {
+	const watchFor = 500 * time.Millisecond
+
+	for _, tc := range []struct {
+		resync  time.Duration
+		updates bool
+	}{
+		{resync: 0, updates: false},
+		{resync: 100 * time.Millisecond, updates: true},
+	} {
+		client := fake.NewSimpleClientset(testIngress("apps", "web", "web.example.com"))
+		var adds, updates int64
+		handler := cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { atomic.AddInt64(&adds, 1) },
+			UpdateFunc: func(old, cur interface{}) { atomic.AddInt64(&updates, 1) },
+		}
+		_, controller := newIngressInformer(client, "apps", tc.resync, handler)
+		stop := make(chan struct{})
+		go controller.Run(stop)
+		if !cache.WaitForCacheSync(stop, controller.HasSynced) {
+			t.Fatal("informer didn't sync")
+		}
+		time.Sleep(watchFor)
+		close(stop)
+
+		if n := atomic.LoadInt64(&adds); n != 1 {
+			t.Errorf("-resync-interval=%s: got %d adds, expected 1", tc.resync, n)
+		}
+		if n := atomic.LoadInt64(&updates); (n > 0) != tc.updates {
+			t.Errorf("-resync-interval=%s: got %d updates within %s", tc.resync, n, watchFor)
+		}
+	}
+}
+
+func TestDeepLinkPath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		href string
+	}{
+		{path: "", href: "http://grafana.example.com"},
+		{path: "/d/overview?orgId=1", href: "http://grafana.example.com/d/overview?orgId=1"},
+		{path: "/", href: "http://grafana.example.com/"},
+		{path: "d/overview", href: "http://grafana.example.com"},               // not absolute
+		{path: "https://evil.example.com", href: "http://grafana.example.com"}, // not a path
+	} {
+		ing := testIngress("apps", "grafana", "grafana.example.com")
+		if tc.path != "" {
+			ing.Annotations = map[string]string{annotationLinkPath: tc.path}
+		}
+		var entries []ingress
+		captureOutput(t, func() { entries = testEntries(t, ing) })
+		if href := entries[0].Href(); href != tc.href {
+			t.Errorf("path %q: got %s, expected %s", tc.path, href, tc.href)
+		}
+	}
+}
+
+func TestNamespacesFlag(t *testing.T) {
+	for _, tc := range []struct {
+		flag, env  string
+		namespaces []string
+	}{
+		{flag: "apps", env: "ops", namespaces: []string{"apps"}},
+		{flag: "", env: "apps, ops", namespaces: []string{"apps", "ops"}},
+		{flag: "  ", env: "ops", namespaces: []string{"ops"}},
+		{flag: "", env: " \t\n"},
+		{flag: "", env: " , "},
+		{flag: "", env: ""},
+	} {
+		getenv := func(key string) string {
+			if key != "NAMESPACES" {
+				t.Fatalf("read %s, expected NAMESPACES", key)
+			}
+			return tc.env
+		}
+		namespaces := parseList(namespacesFlag(tc.flag, getenv))
+		if !reflect.DeepEqual(namespaces, tc.namespaces) {
+			t.Errorf("-namespaces=%q NAMESPACES=%q: got %q, expected %q", tc.flag, tc.env, namespaces, tc.namespaces)
+		}
+		err := requireNamespaces(namespaces)
+		if tc.namespaces == nil && err != errNoNamespaces {
+			t.Errorf("-namespaces=%q NAMESPACES=%q: got error %v, expected no namespaces", tc.flag, tc.env, err)
+		}
+		if tc.namespaces != nil && err != nil {
+			t.Errorf("-namespaces=%q NAMESPACES=%q: got error %v", tc.flag, tc.env, err)
+		}
+	}
+}
+
+func TestSortLocale(t *testing.T) {
+	names := []string{"zebra", "Ärzte", "apps", "émile", "Eagle", "ops"}
+
+	for _, tc := range []struct {
+		locale string
+		order  []string
+	}{
+		// byte order of the lowercased names puts accented letters last
+		{locale: "", order: []string{"apps", "eagle", "ops", "zebra", "ärzte", "émile"}},
+		{locale: "de", order: []string{"apps", "ärzte", "eagle", "émile", "ops", "zebra"}},
+		{locale: "fr", order: []string{"apps", "ärzte", "eagle", "émile", "ops", "zebra"}},
+	} {
+		setFlag(t, flagSortLocale, tc.locale)
+
+		var ings []ingress
+		for _, name := range names {
+			ings = append(ings, ingress{Namespace: "default", Name: name})
+		}
+		sortIngresses(ings)
+		var order []string
+		for _, ing := range ings {
+			order = append(order, strings.ToLower(ing.Name))
+		}
+		if !reflect.DeepEqual(order, tc.order) {
+			t.Errorf("-sort-locale=%q: got %v, expected %v", tc.locale, order, tc.order)
+		}
+	}
+}
+
+func TestDeleteIngress(t *testing.T) {
+	setFlag(t, flagAllHosts, true)
+	watchTestNamespace(t, "apps")
+	web := testIngress("apps", "web", "web.example.com", "www.example.com")
+	noRules := web.DeepCopy()
+	noRules.Spec.Rules = nil
+
+	for _, tc := range []struct {
+		name    string
+		deleted interface{}
+	}{
+		{name: "object", deleted: web},
+		{name: "tombstone", deleted: cache.DeletedFinalStateUnknown{Key: "apps/web", Obj: web}},
+		{name: "no longer builds", deleted: noRules},
+		{name: "tombstone which no longer builds", deleted: cache.DeletedFinalStateUnknown{Key: "apps/web", Obj: noRules}},
+	} {
+		accum := &ingresses{}
+		respChan := make(chan []ingress, 10)
+		handler := ingressEventHandler(accum, respChan)
+		captureOutput(t, func() {
+			handler.AddFunc(testIngress("apps", "grafana", "grafana.example.com"))
+			handler.AddFunc(web)
+			handler.DeleteFunc(tc.deleted)
+		})
+
+		var got []string
+		for _, ing := range latestSnapshot(respChan) {
+			got = append(got, ing.FQDN)
+		}
+		if want := []string{"http://grafana.example.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v after the delete, expected %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestSSLRedirectAnnotations(t *testing.T) {
+	nginx := map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true"}
+	custom := map[string]string{"example.com/https-only": "true"}
+
+	for _, tc := range []struct {
+		name        string
+		keys        string
+		annotations map[string]string
+		fqdn        string
+	}{
+		{name: "nginx with the defaults", keys: defaultSSLRedirectAnnotations, annotations: nginx, fqdn: "https://app.example.com"},
+		{name: "nginx disabled with the defaults", keys: defaultSSLRedirectAnnotations, annotations: map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "false"}, fqdn: "http://app.example.com"},
+		{name: "custom with the defaults", keys: defaultSSLRedirectAnnotations, annotations: custom, fqdn: "http://app.example.com"},
+		{name: "custom when overridden", keys: "example.com/https-only", annotations: custom, fqdn: "https://app.example.com"},
+		{name: "nginx when overridden", keys: "example.com/https-only", annotations: nginx, fqdn: "http://app.example.com"},
+		{name: "nginx when disabled", keys: "", annotations: nginx, fqdn: "http://app.example.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagSSLRedirectAnnotations, tc.keys)
+
+			ing := testIngress("apps", "app", "app.example.com")
+			ing.Annotations = tc.annotations
+			fqdn, err := buildFQDN(ing, fmt.Printf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fqdn != tc.fqdn {
+				t.Errorf("got %s, expected %s", fqdn, tc.fqdn)
+			}
+		})
+	}
+}
+
+func TestSkipTLSVerify(t *testing.T) {
+	kubeconfig := writeTempFile(t, "kubeconfig", `apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com:6443
+    certificate-authority-data: `+base64.StdEncoding.EncodeToString([]byte("not a real CA"))+`
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+current-context: dev
+users:
+- name: dev
+  user:
+    token: secret
+`)
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureOutput(t, func() { skipTLSVerify(config) })
+	if !strings.HasPrefix(out, "WARNING: -insecure-skip-tls-verify is set") {
+		t.Errorf("got %q, expected a warning", out)
+	}
+	if !config.TLSClientConfig.Insecure {
+		t.Error("the config still verifies the API server's certificate")
+	}
+	if _, err := rest.TransportFor(config); err != nil {
+		t.Errorf("client-go rejects the config, err=%v", err)
+	}
+}
+
+func TestSchemesAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		schemes  string
+		allHosts bool
+		fqdns    []string
+	}{
+		{schemes: "http,https", fqdns: []string{"http://app.example.com", "https://app.example.com"}},
+		{schemes: "https, http", fqdns: []string{"https://app.example.com", "http://app.example.com"}},
+		{schemes: "HTTPS,https", fqdns: []string{"https://app.example.com"}},
+		{schemes: "http,ftp,https", fqdns: []string{"http://app.example.com", "https://app.example.com"}},
+		{schemes: "ftp", fqdns: []string{"http://app.example.com"}}, // nothing valid, the computed scheme
+		{schemes: "http,https", allHosts: true, fqdns: []string{"http://app.example.com", "https://app.example.com", "http://www.example.com", "https://www.example.com"}},
+	} {
+		setFlag(t, flagAllHosts, tc.allHosts)
+
+		ing := testIngress("apps", "app", "app.example.com", "www.example.com")
+		ing.Annotations = map[string]string{annotationSchemes: tc.schemes}
+		var entries []ingress
+		captureOutput(t, func() { entries = testEntries(t, ing) })
+
+		var fqdns []string
+		ids := make(map[string]bool)
+		for _, entry := range entries {
+			fqdns = append(fqdns, entry.FQDN)
+			ids[entry.ID] = true
+		}
+		if !reflect.DeepEqual(fqdns, tc.fqdns) {
+			t.Errorf("%q: got %v, expected %v", tc.schemes, fqdns, tc.fqdns)
+		}
+		if len(ids) != len(entries) {
+			t.Errorf("%q: entries share IDs", tc.schemes)
+		}
+	}
+}
+
+func TestCollisionPolicy(t *testing.T) {
+	older := testIngress("a", "grafana", "grafana.a.example.com")
+	newer := testIngress("b", "grafana", "grafana.b.example.com")
+	newer.CreationTimestamp = k8sMeta.NewTime(older.CreationTimestamp.Add(time.Hour))
+
+	for _, tc := range []struct {
+		policy string
+		fqdns  []string
+		merged []string
+	}{
+		{policy: collisionSeparate, fqdns: []string{"http://grafana.a.example.com", "http://grafana.b.example.com"}},
+		{policy: collisionMerge, fqdns: []string{"http://grafana.a.example.com"}, merged: []string{"http://grafana.b.example.com"}},
+		{policy: collisionLastWins, fqdns: []string{"http://grafana.b.example.com"}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			setFlag(t, flagCollisionPolicy, tc.policy)
+
+			accum := &ingresses{}
+			accum.upsert(testEntries(t, older))
+			got := accum.upsert(testEntries(t, newer))
+			sortIngresses(got)
+			var fqdns []string
+			for _, ing := range got {
+				fqdns = append(fqdns, ing.FQDN)
+			}
+			if !reflect.DeepEqual(fqdns, tc.fqdns) {
+				t.Errorf("got FQDNs %v, expected %v", fqdns, tc.fqdns)
+			}
+			if !reflect.DeepEqual(got[0].MergedFQDNs, tc.merged) {
+				t.Errorf("got merged FQDNs %v, expected %v", got[0].MergedFQDNs, tc.merged)
+			}
+		})
+	}
+}
+
+func TestLastWinsKeepsLosers(t *testing.T) {
+	setFlag(t, flagCollisionPolicy, collisionLastWins)
+
+	older := testIngress("a", "grafana", "grafana.a.example.com")
+	newer := testIngress("b", "grafana", "grafana.b.example.com")
+	newer.CreationTimestamp = k8sMeta.NewTime(older.CreationTimestamp.Add(time.Hour))
+
+	accum := &ingresses{}
+	accum.upsert(testEntries(t, older))
+	accum.upsert(testEntries(t, newer))
+
+	// resyncs deliver both again in any order, the winner stays the same
+	for _, ing := range []*k8sNetworking.Ingress{newer, older, newer} {
+		got := accum.upsert(testEntries(t, ing))
+		if len(got) != 1 || got[0].Namespace != "b" {
+			t.Fatalf("after resyncing %s got %v, expected only b/grafana", ing.Namespace, got)
+		}
+	}
+
+	got := accum.delete(testEntries(t, newer)[0])
+	if len(got) != 1 || got[0].Namespace != "a" {
+		t.Fatalf("after deleting the winner got %v, expected a/grafana", got)
+	}
+}
+
+func TestRepeatedHosts(t *testing.T) {
+	ing := testIngress("apps", "shop", "shop.example.com", "shop.example.com", "SHOP.example.com", "api.example.com")
+	for i, path := range []string{"/", "/cart", "/cart", "/v1"} {
+		ing.Spec.Rules[i].HTTP = &k8sNetworking.HTTPIngressRuleValue{
+			Paths: []k8sNetworking.HTTPIngressPath{{Path: path}},
+		}
+	}
+
+	for _, tc := range []struct {
+		paths bool
+		fqdns []string
+	}{
+		{paths: false, fqdns: []string{"http://shop.example.com", "http://api.example.com"}},
+		{paths: true, fqdns: []string{"http://shop.example.com/", "http://shop.example.com/cart", "http://api.example.com/v1"}},
+	} {
+		setFlag(t, flagIncludePaths, tc.paths)
+		setFlag(t, flagAllHosts, true)
+
+		var fqdns []string
+		for _, entry := range testEntries(t, ing) {
+			fqdns = append(fqdns, entry.FQDN)
+		}
+		if !reflect.DeepEqual(fqdns, tc.fqdns) {
+			t.Errorf("-include-paths=%v: got %v, expected %v", tc.paths, fqdns, tc.fqdns)
+		}
+	}
+}
+
+func TestSkipReasons(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		flag    func(t *testing.T)
+		ingress *k8sNetworking.Ingress
+		code    string
+	}{
+		{name: "no rules", ingress: testIngress("apps", "web"), code: skipNoRules},
+		{name: "no host", ingress: testIngress("apps", "web", ""), code: skipNoHost},
+		{name: "wildcard host", ingress: testIngress("apps", "web", "*.example.com"), code: skipInvalidHost},
+		{name: "no load balancer", flag: func(t *testing.T) { setFlag(t, flagRequireLB, true) }, ingress: testIngress("apps", "web", "web.example.com"), code: skipNoLB},
+		{name: "no backend port", flag: func(t *testing.T) { setFlag(t, flagBackendPortName, "http") }, ingress: testIngress("apps", "web", "web.example.com"), code: skipNoPortName},
+		{name: "not owned", flag: func(t *testing.T) { setFlag(t, flagOwnerKind, "Application") }, ingress: testIngress("apps", "web", "web.example.com"), code: skipNotOwned},
+		{name: "listed", ingress: testIngress("apps", "web", "web.example.com")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.flag != nil {
+				tc.flag(t)
+			}
+			var err error
+			captureOutput(t, func() { _, err = buildIngress(tc.ingress, fmt.Printf) })
+
+			var reason *skipReason
+			if tc.code == "" {
+				if err != nil {
+					t.Errorf("got error %v, expected it to be listed", err)
+				}
+				return
+			}
+			if !errors.As(err, &reason) {
+				t.Fatalf("got error %v, expected a *skipReason", err)
+			}
+			if reason.Code != tc.code {
+				t.Errorf("got code %s, expected %s", reason.Code, tc.code)
+			}
+		})
+	}
+}
+
+func TestSnapshotKeepsStaticLinks(t *testing.T) {
+	cm := &k8sCore.ConfigMap{
+		ObjectMeta: k8sMeta.ObjectMeta{Namespace: "apps", Name: "links"},
+		Data:       map[string]string{"docs": "https://docs.example.com"},
+	}
+	accum := &ingresses{}
+	accum.upsert(testEntries(t, testIngress("apps", "docs", "docs.apps.example.com")))
+	accum.replaceStatic(staticEntries(cm))
+
+	got := accum.current()
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, expected the Ingress and the static link: %v", len(got), got)
+	}
+
+	// updating the Ingress leaves the static link of the same name alone
+	got = accum.upsert(testEntries(t, testIngress("apps", "docs", "docs2.apps.example.com")))
+	if len(got) != 2 {
+		t.Fatalf("got %d entries after an update, expected 2: %v", len(got), got)
+	}
+}
+
+func TestIdentityIncludesClass(t *testing.T) {
+	withClass := func(class string) *k8sNetworking.Ingress {
+		ing := testIngress("apps", "web", "web.example.com")
+		ing.Spec.IngressClassName = &class
+		return ing
+	}
+
+	for _, tc := range []struct {
+		flag    bool
+		entries int
+	}{
+		{flag: false, entries: 1},
+		{flag: true, entries: 2},
+	} {
+		setFlag(t, flagIdentityIncludesClass, tc.flag)
+
+		accum := &ingresses{}
+		accum.upsert(testEntries(t, withClass("nginx")))
+		got := accum.upsert(testEntries(t, withClass("traefik")))
+		if len(got) != tc.entries {
+			t.Fatalf("-identity-includes-class=%v: got %d entries, expected %d", tc.flag, len(got), tc.entries)
+		}
+		if tc.flag && got[0].ID == got[1].ID {
+			t.Errorf("-identity-includes-class=%v: both classes have id %s", tc.flag, got[0].ID)
+		}
+	}
+}
+
+func TestTLSModeDefault(t *testing.T) {
+	if *flagForceTLS || *flagTLSMode != "" {
+		t.Fatalf("got -force-tls=%v -tls-mode=%q by default, expected neither", *flagForceTLS, *flagTLSMode)
+	}
+
+	secure := testIngress("apps", "secure", "secure.example.com")
+	secure.Spec.TLS = []k8sNetworking.IngressTLS{{Hosts: []string{"secure.example.com"}}}
+	plain := testIngress("apps", "plain", "plain.example.com")
+
+	for _, tc := range []struct {
+		name      string
+		forceTLS  bool
+		mode      string
+		effective string
+		plain     string
+	}{
+		{name: "default", effective: tlsModeAuto, plain: "http://plain.example.com"},
+		{name: "-force-tls", forceTLS: true, effective: tlsModeForce, plain: "https://plain.example.com"},
+		{name: "-tls-mode=auto overrides -force-tls", forceTLS: true, mode: tlsModeAuto, effective: tlsModeAuto, plain: "http://plain.example.com"},
+		{name: "-tls-mode=force", mode: tlsModeForce, effective: tlsModeForce, plain: "https://plain.example.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagForceTLS, tc.forceTLS)
+			setFlag(t, flagTLSMode, tc.mode)
+
+			if mode := tlsMode(); mode != tc.effective {
+				t.Errorf("got mode %s, expected %s", mode, tc.effective)
+			}
+			if fqdn, _ := buildFQDN(plain, fmt.Printf); fqdn != tc.plain {
+				t.Errorf("got %s for a plain Ingress, expected %s", fqdn, tc.plain)
+			}
+			if fqdn, _ := buildFQDN(secure, fmt.Printf); fqdn != "https://secure.example.com" {
+				t.Errorf("got %s for an Ingress with TLS, expected https", fqdn)
+			}
+		})
+	}
+}
+
+func TestRequireLB(t *testing.T) {
+	setFlag(t, flagRequireLB, true)
+
+	for _, tc := range []struct {
+		name   string
+		status []k8sCore.LoadBalancerIngress
+		listed bool
+	}{
+		{name: "empty", listed: false},
+		{name: "ip", status: []k8sCore.LoadBalancerIngress{{IP: "203.0.113.10"}}, listed: true},
+		{name: "hostname", status: []k8sCore.LoadBalancerIngress{{Hostname: "lb.example.com"}}, listed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ing := testIngress("apps", "web", "web.example.com")
+			ing.Status.LoadBalancer.Ingress = tc.status
+			_, err := buildEntries(ing, fmt.Printf)
+			if listed := err == nil; listed != tc.listed {
+				t.Errorf("got listed %v (err=%v), expected %v", listed, err, tc.listed)
+			}
+		})
+	}
+
+	// the entry appears once the controller assigns an address
+	watchTestNamespace(t, "apps")
+	accum := &ingresses{}
+	handler := ingressEventHandler(accum, make(chan []ingress, 10))
+	pending := testIngress("apps", "web", "web.example.com")
+	ready := pending.DeepCopy()
+	ready.Status.LoadBalancer.Ingress = []k8sCore.LoadBalancerIngress{{IP: "203.0.113.10"}}
+	captureOutput(t, func() {
+		handler.AddFunc(pending)
+		if n := len(accum.current()); n != 0 {
+			t.Errorf("got %d entries before the address is assigned, expected none", n)
+		}
+		handler.UpdateFunc(pending, ready)
+	})
+	if n := len(accum.current()); n != 1 {
+		t.Errorf("got %d entries once the address is assigned, expected 1", n)
+	}
+}
+
+func TestMalformedHosts(t *testing.T) {
+	for _, tc := range []struct {
+		host string
+		fqdn string // empty when the host is rejected
+	}{
+		{host: "web.example.com", fqdn: "http://web.example.com"},
+		{host: "Web.Example.COM", fqdn: "http://web.example.com"},
+		{host: "203.0.113.10", fqdn: "http://203.0.113.10"},
+		{host: "*.example.com"},
+		{host: "web_app.example.com"},
+		{host: "web..example.com"},
+		{host: "-web.example.com"},
+		{host: "web.example.com/path"},
+		{host: "web example.com"},
+		{host: "user@web.example.com"},
+		{host: "web.example.com:8080"},
+		{host: "localhost:8080"},
+		{host: "%zz"},
+	} {
+		var fqdn string
+		var err error
+		out := captureOutput(t, func() { fqdn, err = buildFQDN(testIngress("apps", "web", tc.host), fmt.Printf) })
+		if tc.fqdn == "" {
+			if err == nil {
+				t.Errorf("%q: got %s, expected it to be rejected", tc.host, fqdn)
+			}
+			continue
+		}
+		if err != nil || fqdn != tc.fqdn {
+			t.Errorf("%q: got %s (err=%v), expected %s", tc.host, fqdn, err, tc.fqdn)
+		}
+		if out != "" {
+			t.Errorf("%q: logged %q for a valid host", tc.host, out)
+		}
+	}
+}
+
+func TestRecentWindow(t *testing.T) {
+	clock := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	setFlag(t, &now, func() time.Time { return clock })
+
+	updated := func(name string, ago time.Duration, subresource string) ingress {
+		ing := testIngress("apps", name, name+".example.com")
+		at := k8sMeta.NewTime(clock.Add(-ago))
+		ing.ManagedFields = []k8sMeta.ManagedFieldsEntry{{Manager: "kubectl", Time: &at, Subresource: subresource}}
+		return testEntries(t, ing)[0]
+	}
+	ings := []ingress{
+		updated("old", 2*time.Hour, ""),
+		updated("edited", 20*time.Minute, ""),
+		updated("fresh", time.Minute, ""),
+		updated("status", time.Minute, "status"), // only its status changed
+	}
+
+	cases := []struct {
+		window   time.Duration
+		expected []string
+	}{
+		{0, nil},
+		{5 * time.Minute, []string{"fresh"}},
+		{30 * time.Minute, []string{"fresh", "edited"}},
+		{24 * time.Hour, []string{"fresh", "edited", "old"}},
+	}
+	for _, tc := range cases {
+		setFlag(t, flagRecentWindow, tc.window)
+		var names []string
+		for _, ing := range (pageData{Ingresses: ings}).Recent() {
+			names = append(names, ing.Name)
+		}
+		if !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("%v: got %v, expected %v", tc.window, names, tc.expected)
+		}
+	}
+}
+
+func TestOversizedAnnotations(t *testing.T) {
+	setFlag(t, flagMaxAnnotationLength, 10)
+
+	cases := []struct {
+		value    string
+		expected string
+		warned   bool
+	}{
+		{"short", "short", false},
+		{"exactly 10", "exactly 10", false},
+		{strings.Repeat("x", 100000), "xxxxxxxxxx…", true},
+		// counted in characters, a multibyte rune is never split
+		{"ünïcödé ünïcödé", "ünïcödé ün…", true},
+	}
+	for _, tc := range cases {
+		ing := testIngress("apps", "web", "web.example.com")
+		ing.Annotations = map[string]string{
+			annotationDescription: tc.value,
+			annotationSection:     tc.value,
+		}
+		var entries []ingress
+		out := captureOutput(t, func() { entries = testEntries(t, ing) })
+		if got := entries[0].Description; got != tc.expected {
+			t.Errorf("got description %q, expected %q", got, tc.expected)
+		}
+		if got := entries[0].Section; got != tc.expected {
+			t.Errorf("got section %q, expected %q", got, tc.expected)
+		}
+		if warned := strings.Contains(out, "WARNING: truncating "+annotationDescription+" annotation on apps/web"); warned != tc.warned {
+			t.Errorf("%q: warned=%v, expected %v: %s", tc.expected, warned, tc.warned, out)
+		}
+	}
+
+	// display names come from the Namespace
+	ns := &k8sCore.Namespace{ObjectMeta: k8sMeta.ObjectMeta{
+		Name:        "apps",
+		Annotations: map[string]string{annotationDisplayName: strings.Repeat("y", 50)},
+	}}
+	var name string
+	captureOutput(t, func() {
+		setNamespace(t, ns)
+		name = namespaceMeta.displayName("apps")
+	})
+	if name != "yyyyyyyyyy…" {
+		t.Errorf("got display name %q", name)
+	}
+
+	setFlag(t, flagMaxAnnotationLength, 0)
+	ing := testIngress("apps", "web", "web.example.com")
+	ing.Annotations = map[string]string{annotationDescription: strings.Repeat("x", 5000)}
+	if got := testEntries(t, ing)[0].Description; len(got) != 5000 {
+		t.Errorf("with no limit, got %d characters", len(got))
+	}
+}
+
+func TestIPHostURLs(t *testing.T) {
+	for _, tc := range []struct {
+		host    string
+		tls     bool
+		path    string
+		defHost string
+		fqdn    string
+	}{
+		{host: "203.0.113.10", fqdn: "http://203.0.113.10"},
+		{host: "2001:db8::1", fqdn: "http://[2001:db8::1]"},
+		{host: "2001:DB8::1", fqdn: "http://[2001:db8::1]"},
+		{host: "::ffff:203.0.113.10", fqdn: "http://[::ffff:203.0.113.10]"},
+		{host: "web.example.com", fqdn: "http://web.example.com"},
+		{host: "2001:db8::1", tls: true, fqdn: "https://[2001:db8::1]"},
+		// path-only rules linked through -default-host
+		{defHost: "2001:db8::2", path: "/grafana", fqdn: "http://[2001:db8::2]/grafana"},
+		{defHost: "198.51.100.7", path: "/grafana", fqdn: "http://198.51.100.7/grafana"},
+	} {
+		setFlag(t, flagDefaultHost, tc.defHost)
+		ing := testIngress("apps", "web", tc.host)
+		if tc.tls {
+			ing.Spec.TLS = []k8sNetworking.IngressTLS{{Hosts: []string{tc.host}}}
+		}
+		if tc.path != "" {
+			ing.Spec.Rules[0].HTTP = &k8sNetworking.HTTPIngressRuleValue{
+				Paths: []k8sNetworking.HTTPIngressPath{{Path: tc.path}},
+			}
+		}
+		entries := testEntries(t, ing)
+		if len(entries) != 1 {
+			t.Errorf("%q: got %d entries, expected 1", tc.host, len(entries))
+			continue
+		}
+		if href := entries[0].Href(); href != tc.fqdn {
+			t.Errorf("%q: got %s, expected %s", tc.host+tc.defHost, href, tc.fqdn)
+		}
+		if _, err := url.Parse(entries[0].Href()); err != nil {
+			t.Errorf("%q: %v", tc.host+tc.defHost, err)
+		}
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		template string
+		item     string
+		err      string
+	}{
+		{name: "valid", template: `{{range .Ingresses}}<a href="{{ .Href }}">{{ .Name }}</a>{{end}}`},
+		{name: "unknown ingress field", template: `{{range .Ingresses}}{{ .Hostname }}{{end}}`, err: "can't evaluate field Hostname"},
+		{name: "unknown page field", template: `{{ .Title }}`, err: "can't evaluate field Title"},
+		{name: "unknown method", template: `{{range .Ingresses}}{{ .URL.Host }}{{end}}`, err: "can't evaluate field URL"},
+		{name: "parse error", template: `{{range .Ingresses}}`, err: "unexpected EOF"},
+		{
+			name:     "unknown field in -item-template",
+			template: `{{range .Ingresses}}{{template "item" .}}{{end}}`,
+			item:     `{{ .Owner }}`,
+			err:      "can't evaluate field Owner",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagItemTemplate, tc.item)
+			path := writeTempFile(t, "index.html", tc.template)
+			tpl, err := loadTemplate(path)
+			if tc.err == "" {
+				if err != nil || tpl == nil {
+					t.Errorf("got error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("got error %v, expected %q", err, tc.err)
+			}
+			if tpl != nil {
+				t.Error("a template failing validation was returned")
+			}
+		})
+	}
+}
+
+func TestBackendPortName(t *testing.T) {
+	port := func(name string, number int32) k8sNetworking.HTTPIngressPath {
+		return k8sNetworking.HTTPIngressPath{
+			Path: "/",
+			Backend: k8sNetworking.IngressBackend{
+				Service: &k8sNetworking.IngressServiceBackend{
+					Name: "app",
+					Port: k8sNetworking.ServiceBackendPort{Name: name, Number: number},
+				},
+			},
+		}
+	}
+	resource := k8sNetworking.HTTPIngressPath{
+		Path: "/static",
+		Backend: k8sNetworking.IngressBackend{
+			Resource: &k8sCore.TypedLocalObjectReference{Kind: "StorageBucket", Name: "assets"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		paths  []k8sNetworking.HTTPIngressPath
+		filter string
+		listed bool
+	}{
+		{name: "named port", paths: []k8sNetworking.HTTPIngressPath{port("web", 0)}, filter: "web", listed: true},
+		{name: "other named port", paths: []k8sNetworking.HTTPIngressPath{port("metrics", 0)}, filter: "web"},
+		{name: "numeric port", paths: []k8sNetworking.HTTPIngressPath{port("", 80)}, filter: "web"},
+		{name: "port named like a number", paths: []k8sNetworking.HTTPIngressPath{port("", 80)}, filter: "80"},
+		{name: "any of several paths", paths: []k8sNetworking.HTTPIngressPath{port("", 9090), resource, port("web", 0)}, filter: "web", listed: true},
+		{name: "resource backend", paths: []k8sNetworking.HTTPIngressPath{resource}, filter: "web"},
+		{name: "no paths", filter: "web"},
+		{name: "no filter", paths: []k8sNetworking.HTTPIngressPath{port("", 80)}, listed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagBackendPortName, tc.filter)
+			ing := testIngress("apps", "web", "web.example.com")
+			if tc.paths != nil {
+				ing.Spec.Rules[0].HTTP = &k8sNetworking.HTTPIngressRuleValue{Paths: tc.paths}
+			}
+			_, err := buildEntries(ing, fmt.Printf)
+			if listed := err == nil; listed != tc.listed {
+				t.Errorf("got listed %v (err=%v), expected %v", listed, err, tc.listed)
+			}
+			if reason, ok := err.(*skipReason); err != nil && (!ok || reason.Code != skipNoPortName) {
+				t.Errorf("skipped for %v, expected %s", err, skipNoPortName)
+			}
+		})
+	}
+}
+
+func TestForcedInsecure(t *testing.T) {
+	setFlag(t, flagTLSMode, tlsModeForce)
+
+	secure := testIngress("apps", "secure", "secure.example.com")
+	secure.Spec.TLS = []k8sNetworking.IngressTLS{{Hosts: []string{"secure.example.com"}}}
+	insecure := testIngress("apps", "insecure", "insecure.example.com")
+
+	var entries []ingress
+	out := captureOutput(t, func() {
+		entries = append(testEntries(t, secure), testEntries(t, insecure)...)
+	})
+	if out != "" {
+		t.Errorf("building entries logged %q, expected nothing", out)
+	}
+	if entries[0].ForcedInsecure || !entries[1].ForcedInsecure {
+		t.Fatalf("got forcedInsecure %v and %v, expected false and true", entries[0].ForcedInsecure, entries[1].ForcedInsecure)
+	}
+
+	// the warning is logged when the entry first appears, not on each resync
+	if out := captureOutput(t, func() { warnForcedInsecure(nil, entries) }); !strings.Contains(out, "apps/insecure") || strings.Contains(out, "apps/secure") {
+		t.Errorf("got %q, expected a warning for apps/insecure only", out)
+	}
+	if out := captureOutput(t, func() { warnForcedInsecure(entries, entries) }); out != "" {
+		t.Errorf("got %q for an unchanged Ingress, expected nothing", out)
+	}
+}
+
+func TestMixedCaseHosts(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		preserve bool
+		hosts    []string
+		tls      []string
+		fqdns    []string
+	}{
+		{
+			name:  "collapsed",
+			hosts: []string{"App.Example.com", "app.example.com", "APP.EXAMPLE.COM"},
+			fqdns: []string{"http://app.example.com"},
+		},
+		{
+			name:  "tls entry cased differently",
+			hosts: []string{"App.Example.com", "app.example.com"},
+			tls:   []string{"APP.example.com"},
+			fqdns: []string{"https://app.example.com"},
+		},
+		{
+			name:     "preserved",
+			preserve: true,
+			hosts:    []string{"App.Example.com", "app.example.com", "App.Example.com"},
+			fqdns:    []string{"http://App.Example.com", "http://app.example.com"},
+		},
+		{
+			name:     "preserved with tls",
+			preserve: true,
+			hosts:    []string{"App.Example.com"},
+			tls:      []string{"app.example.com"},
+			fqdns:    []string{"https://App.Example.com"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagPreserveHostCase, tc.preserve)
+			ing := testIngress("apps", "web", tc.hosts...)
+			if tc.tls != nil {
+				ing.Spec.TLS = []k8sNetworking.IngressTLS{{Hosts: tc.tls}}
+			}
+			if got := buildFQDNs(ing, fmt.Printf); !reflect.DeepEqual(got, tc.fqdns) {
+				t.Errorf("got %v, expected %v", got, tc.fqdns)
+			}
+		})
+	}
+
+	// Ingresses whose hosts only differ by case link to the same FQDN, so
+	// they're listed as conflicting rather than as two different sites
+	watchTestNamespace(t, "apps")
+	respChan := make(chan []ingress, 10)
+	handler := ingressEventHandler(&ingresses{}, respChan)
+	captureOutput(t, func() {
+		handler.AddFunc(testIngress("apps", "web", "App.Example.com"))
+		handler.AddFunc(testIngress("apps", "web-canary", "app.example.com"))
+	})
+	ings := latestSnapshot(respChan)
+	if len(ings) != 2 {
+		t.Fatalf("got %d entries, expected 2", len(ings))
+	}
+	for _, ing := range ings {
+		if ing.FQDN != "http://app.example.com" || len(ing.Conflicts) != 1 {
+			t.Errorf("%s: got FQDN %s and conflicts %v", ing.key(), ing.FQDN, ing.Conflicts)
+		}
+	}
+
+	setFlag(t, flagCollisionPolicy, collisionMerge)
+	web := testIngress("apps", "web", "App.Example.com")
+	captureOutput(t, func() { handler.UpdateFunc(web, web) })
+	if merged := latestSnapshot(respChan); len(merged) != 1 {
+		t.Errorf("with -collision-policy=merge got %d entries, expected 1", len(merged))
+	}
+}
+
+func TestOwnerKind(t *testing.T) {
+	argo := k8sMeta.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Application", Name: "web"}
+	flux := k8sMeta.OwnerReference{APIVersion: "helm.toolkit.fluxcd.io/v2beta1", Kind: "HelmRelease", Name: "web"}
+	core := k8sMeta.OwnerReference{APIVersion: "v1", Kind: "Service", Name: "web"}
+
+	for _, tc := range []struct {
+		name   string
+		filter string
+		owners []k8sMeta.OwnerReference
+		listed bool
+	}{
+		{name: "matching kind", filter: "Application", owners: []k8sMeta.OwnerReference{argo}, listed: true},
+		{name: "kind ignores case", filter: "application", owners: []k8sMeta.OwnerReference{argo}, listed: true},
+		{name: "matching kind and group", filter: "Application.argoproj.io", owners: []k8sMeta.OwnerReference{argo}, listed: true},
+		{name: "any of several owners", filter: "Application", owners: []k8sMeta.OwnerReference{flux, argo}, listed: true},
+		{name: "core group", filter: "Service", owners: []k8sMeta.OwnerReference{core}, listed: true},
+		{name: "other kind", filter: "Application", owners: []k8sMeta.OwnerReference{flux}},
+		{name: "other group", filter: "Application.example.com", owners: []k8sMeta.OwnerReference{argo}},
+		{name: "no owners", filter: "Application"},
+		{name: "no filter", owners: nil, listed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagOwnerKind, tc.filter)
+			ing := testIngress("apps", "web", "web.example.com")
+			ing.OwnerReferences = tc.owners
+			_, err := buildEntries(ing, fmt.Printf)
+			if listed := err == nil; listed != tc.listed {
+				t.Errorf("got listed %v (err=%v), expected %v", listed, err, tc.listed)
+			}
+			if reason, ok := err.(*skipReason); err != nil && (!ok || reason.Code != skipNotOwned) {
+				t.Errorf("skipped for %v, expected %s", err, skipNotOwned)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maintenanceMode is switched on during cluster maintenance, pages then show
+// a banner since their links may be stale.
+type maintenanceMode struct {
+	enabled bool
+	mu      sync.RWMutex
+}
+
+func (m *maintenanceMode) set(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enabled = enabled
+}
+
+func (m *maintenanceMode) active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.enabled
+}
+
+// loadAdminToken returns the -admin-token, read from a file when it's given
+// as @path.
+func loadAdminToken(in string) (string, error) {
+	if strings.HasPrefix(in, "@") {
+		bs, err := os.ReadFile(in[1:])
+		if err != nil {
+			return "", err
+		}
+		in = string(bs)
+	}
+	return strings.TrimSpace(in), nil
+}
+
+// authorized reports if r carries token as a bearer token.
+func authorized(r *http.Request, token string) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// serveMaintenance reports whether maintenance mode is on, and switches it
+// with a POST of ?enabled=true or false. Requests must be authorized with
+// token.
+func serveMaintenance(m *maintenanceMode, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-ingress-index"`)
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+			if err != nil {
+				http.Error(w, "400 bad request: enabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			m.set(enabled)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Enabled bool `json:"enabled"`
+		}{m.active()})
+	}
+}
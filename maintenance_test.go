@@ -0,0 +1,84 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	setFlag(t, flagAdminToken, "hunter2")
+	setFlag(t, flagMaintenanceMessage, "Upgrading the cluster")
+	t.Cleanup(func() { maintenance.set(false) })
+
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	toggle := func(query, token string) int {
+		r := httptest.NewRequest("POST", "/admin/maintenance"+query, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	banner := func() bool {
+		_, body := get(t, srv, "/")
+		return strings.Contains(body, "Upgrading the cluster")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		token  string
+		code   int
+		banner bool
+	}{
+		{name: "off by default", banner: false},
+		{name: "unauthorized", query: "?enabled=true", code: http.StatusUnauthorized, banner: false},
+		{name: "wrong token", query: "?enabled=true", token: "wrong", code: http.StatusUnauthorized, banner: false},
+		{name: "invalid", query: "?enabled=maybe", token: "hunter2", code: http.StatusBadRequest, banner: false},
+		{name: "switched on", query: "?enabled=true", token: "hunter2", code: http.StatusOK, banner: true},
+		{name: "switched off", query: "?enabled=false", token: "hunter2", code: http.StatusOK, banner: false},
+	} {
+		if tc.code != 0 {
+			if code := toggle(tc.query, tc.token); code != tc.code {
+				t.Errorf("%s: got %d, expected %d", tc.name, code, tc.code)
+			}
+		}
+		if got := banner(); got != tc.banner {
+			t.Errorf("%s: got banner %v, expected %v", tc.name, got, tc.banner)
+		}
+	}
+}
+
+func TestMaintenanceDisablesLinks(t *testing.T) {
+	setFlag(t, flagMaintenanceLinks, true)
+	maintenance.set(true)
+	t.Cleanup(func() { maintenance.set(false) })
+
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	for _, theme := range themeNames() {
+		_, body := get(t, srv, "/?theme="+theme)
+		if !strings.Contains(body, *flagMaintenanceMessage) {
+			t.Errorf("%s: the banner is missing", theme)
+		}
+		if strings.Contains(body, `href="http://grafana.example.com`) {
+			t.Errorf("%s: entries still link to their Ingress", theme)
+		}
+	}
+}
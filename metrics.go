@@ -0,0 +1,222 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counter is a monotonically increasing value exposed in the Prometheus text
+// format on /metrics.
+type counter struct {
+	name, help string
+	value      uint64
+}
+
+func (c *counter) inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// histogram counts observations into buckets, exposed on /metrics like a
+// Prometheus histogram. Each bucket keeps the latest exemplar observed into
+// it, which is only exposed in the OpenMetrics format.
+type histogram struct {
+	name, help string
+	bounds     []float64 // upper bounds of the buckets, ascending
+
+	mu        sync.Mutex
+	counts    []uint64 // per bucket, the last is +Inf
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+// exemplar is an observation labeled with the trace it belongs to.
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// observe records v, along with an exemplar for traceID unless it's empty.
+func (h *histogram) observe(v float64, traceID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	if traceID != "" {
+		h.exemplars[i] = &exemplar{traceID: traceID, value: v, at: time.Now()}
+	}
+}
+
+var (
+	metricsMu  sync.Mutex
+	counters   []*counter
+	histograms []*histogram
+
+	snapshotDrops    = newCounter("kube_ingress_index_snapshot_drops_total", "Snapshots of the index replaced before they were rendered.")
+	informerRestarts = newCounter("kube_ingress_index_informer_restarts_total", "Informers restarted by the watchdog after going quiet.")
+
+	requestDuration = newHistogram("kube_ingress_index_http_request_duration_seconds", "Time taken to answer HTTP requests.",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10})
+)
+
+// newCounter registers a counter to be exposed on /metrics.
+func newCounter(name, help string) *counter {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	c := &counter{name: name, help: help}
+	counters = append(counters, c)
+	return c
+}
+
+// newHistogram registers a histogram with buckets up to each of bounds, and
+// +Inf, to be exposed on /metrics.
+func newHistogram(name, help string, bounds []float64) *histogram {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	h := &histogram{
+		name:      name,
+		help:      help,
+		bounds:    bounds,
+		counts:    make([]uint64, len(bounds)+1),
+		exemplars: make([]*exemplar, len(bounds)+1),
+	}
+	histograms = append(histograms, h)
+	return h
+}
+
+// openMetricsType is the content type of the OpenMetrics format, the only
+// one exemplars can be written in.
+const openMetricsType = "application/openmetrics-text"
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), openMetricsType)
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsType+"; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	for _, c := range counters {
+		family := c.name
+		if openMetrics {
+			// OpenMetrics names the family of a counter without _total
+			family = strings.TrimSuffix(c.name, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", family, c.help, family, c.name, atomic.LoadUint64(&c.value))
+	}
+	for _, h := range histograms {
+		h.write(w, openMetrics)
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// write writes h in the text format, with exemplars when openMetrics is set.
+func (h *histogram) write(w io.Writer, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	var cumulative uint64
+	for i := range h.counts {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatFloat(h.bounds[i])
+		}
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d", h.name, le, cumulative)
+		if e := h.exemplars[i]; openMetrics && e != nil {
+			fmt.Fprintf(w, " # {trace_id=%q} %s %.3f", e.traceID, formatFloat(e.value), float64(e.at.UnixNano())/1e9)
+		}
+		fmt.Fprint(w, "\n")
+	}
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// observeRequests records how long next takes to answer each request. With
+// -trace-exemplars the trace ID of a sampled request is attached as an
+// exemplar, otherwise none are.
+func observeRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+
+		var traceID string
+		if *flagTraceExemplars {
+			traceID = sampledTraceID(r.Header.Get("traceparent"))
+		}
+		requestDuration.observe(time.Since(start).Seconds(), traceID)
+	})
+}
+
+// sampledTraceID returns the trace ID of a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01, when its sampled
+// flag is set. It's empty when the header is missing, malformed or not
+// sampled, as there's no trace to link to.
+func sampledTraceID(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ""
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return ""
+	}
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return ""
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "" // all zeros is invalid
+	}
+	flags, _ := strconv.ParseUint(parts[3], 16, 8)
+	if flags&1 == 0 {
+		return ""
+	}
+	return parts[1]
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSampledTraceID(t *testing.T) {
+	for _, tc := range []struct {
+		header, expected string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ""}, // not sampled
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ""},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", ""},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", ""},
+		{"garbage", ""},
+		{"", ""},
+	} {
+		if got := sampledTraceID(tc.header); got != tc.expected {
+			t.Errorf("%q: got %q, expected %q", tc.header, got, tc.expected)
+		}
+	}
+}
+
+func TestRequestExemplars(t *testing.T) {
+	setFlag(t, &histograms, nil)
+	setFlag(t, &requestDuration, newHistogram("test_request_duration_seconds", "Test requests.", []float64{.1, 1}))
+
+	const (
+		sampled   = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		unsampled = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"
+	)
+	scrape := func(openMetrics bool) string {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if openMetrics {
+			r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+		}
+		rec := httptest.NewRecorder()
+		serveMetrics(rec, r)
+		return rec.Body.String()
+	}
+	h := observeRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(traceparent string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		if traceparent != "" {
+			r.Header.Set("traceparent", traceparent)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// disabled, the requests are counted without exemplars
+	request(sampled)
+	request("")
+	if body := scrape(true); strings.Contains(body, "trace_id") || !strings.Contains(body, "test_request_duration_seconds_count 2\n") {
+		t.Errorf("without -trace-exemplars got:\n%s", body)
+	}
+
+	setFlag(t, flagTraceExemplars, true)
+	request(unsampled)
+	if body := scrape(true); strings.Contains(body, "trace_id") {
+		t.Errorf("an unsampled request left an exemplar:\n%s", body)
+	}
+	request(sampled)
+	body := scrape(true)
+	if want := `test_request_duration_seconds_bucket{le="0.1"} 4 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} `; !strings.Contains(body, want) {
+		t.Errorf("OpenMetrics is missing %q:\n%s", want, body)
+	}
+	for _, want := range []string{
+		"# TYPE kube_ingress_index_snapshot_drops counter\nkube_ingress_index_snapshot_drops_total ",
+		`test_request_duration_seconds_bucket{le="+Inf"} 4` + "\n",
+		"test_request_duration_seconds_count 4\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("OpenMetrics is missing %q:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("OpenMetrics doesn't end with # EOF:\n%s", body)
+	}
+
+	// the Prometheus text format has no exemplars
+	body = scrape(false)
+	if strings.Contains(body, "trace_id") || strings.Contains(body, "# EOF") {
+		t.Errorf("the text format has OpenMetrics lines:\n%s", body)
+	}
+	if want := "# TYPE kube_ingress_index_snapshot_drops_total counter\n"; !strings.Contains(body, want) {
+		t.Errorf("the text format is missing %q:\n%s", want, body)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+
+	k8sCore "k8s.io/api/core/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// annotationDisplayName on a Namespace gives the heading it's grouped under
+const annotationDisplayName = "index.k8s.io/display-name"
+
+// namespaceIndex holds metadata of the Namespace objects we've seen.
+type namespaceIndex struct {
+	labels       map[string]map[string]string
+	displayNames map[string]string
+	mu           sync.RWMutex
+}
+
+func (n *namespaceIndex) set(ns *k8sCore.Namespace) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.labels == nil {
+		n.labels = make(map[string]map[string]string)
+	}
+	n.labels[ns.Name] = ns.Labels
+
+	if n.displayNames == nil {
+		n.displayNames = make(map[string]string)
+	}
+	if name := strings.TrimSpace(annotationText(ns.ObjectMeta, annotationDisplayName, fmt.Printf)); name != "" {
+		n.displayNames[ns.Name] = name
+	} else {
+		delete(n.displayNames, ns.Name)
+	}
+}
+
+func (n *namespaceIndex) delete(ns *k8sCore.Namespace) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.labels, ns.Name)
+	delete(n.displayNames, ns.Name)
+}
+
+// displayName returns the friendly name of the namespace ns, or ns itself
+// when it has none.
+func (n *namespaceIndex) displayName(ns string) string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if name, ok := n.displayNames[ns]; ok {
+		return name
+	}
+	return ns
+}
+
+// namespaceGroup is the Ingresses of one namespace, or of one section when
+// they're annotated with one, as shown by the grouped theme.
+type namespaceGroup struct {
+	// Namespace is empty for a section, which can span namespaces
+	Namespace   string
+	Section     string
+	DisplayName string
+	Ingresses   []ingress
+}
+
+// Orders of the namespace groups
+const (
+	// sortByName keeps groups in namespace order
+	sortByName = "name"
+
+	// sortByNamespaceCount puts the namespaces with the most Ingresses first
+	sortByNamespaceCount = "namespace-count"
+)
+
+// groupByNamespace splits the sorted ings into one group per namespace, in
+// the order they're first seen or by descending size with
+// -sort-by=namespace-count. Ingresses with a section annotation are grouped
+// under their section instead, whichever namespace they're in.
+func (n *namespaceIndex) groupByNamespace(ings []ingress) []namespaceGroup {
+	var groups []namespaceGroup
+	seen := make(map[string]int)
+	for _, ing := range ings {
+		key := "namespace/" + ing.Namespace
+		group := namespaceGroup{Namespace: ing.Namespace}
+		if ing.Section != "" {
+			key = "section/" + ing.Section
+			group = namespaceGroup{Section: ing.Section, DisplayName: ing.Section}
+		}
+		idx, ok := seen[key]
+		if !ok {
+			if group.DisplayName == "" {
+				group.DisplayName = n.displayName(ing.Namespace)
+			}
+			idx = len(groups)
+			seen[key] = idx
+			groups = append(groups, group)
+		}
+		groups[idx].Ingresses = append(groups[idx].Ingresses, ing)
+	}
+	if liveConfig.sortBy() == sortByNamespaceCount {
+		sort.SliceStable(groups, func(i, j int) bool {
+			if len(groups[i].Ingresses) != len(groups[j].Ingresses) {
+				return len(groups[i].Ingresses) > len(groups[j].Ingresses)
+			}
+			return groups[i].DisplayName < groups[j].DisplayName
+		})
+	}
+	return groups
+}
+
+// dataAttrs renders the labels in keys of the namespace ns as data-*
+// attributes, e.g. ` data-team="platform"`. Missing labels are skipped.
+func (n *namespaceIndex) dataAttrs(ns string, keys []string) template.HTMLAttr {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var buf strings.Builder
+	for _, key := range keys {
+		value, ok := n.labels[ns][key]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&buf, ` data-%s="%s"`, dataAttrName(key), template.HTMLEscapeString(value))
+	}
+	return template.HTMLAttr(buf.String())
+}
+
+// dataAttrName converts a label key into a valid data-* attribute suffix by
+// lowercasing it and replacing anything other than letters and digits with '-'.
+func dataAttrName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, key)
+}
+
+// parseList splits a comma separated flag value, dropping empty items.
+func parseList(in string) []string {
+	var out []string
+	for _, item := range strings.Split(in, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func watchNamespaces(kubeClient kubernetes.Interface, index *namespaceIndex) {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*k8sCore.Namespace); ok {
+				index.set(ns)
+			}
+		},
+		UpdateFunc: func(_, cur interface{}) {
+			if ns, ok := cur.(*k8sCore.Namespace); ok {
+				index.set(ns)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if ns, ok := obj.(*k8sCore.Namespace); ok {
+				index.delete(ns)
+			}
+		},
+	}
+	watch := &cache.ListWatch{
+		ListFunc: func(opts k8sMeta.ListOptions) (runtime.Object, error) {
+			return kubeClient.CoreV1().Namespaces().List(ctx, opts)
+		},
+		WatchFunc: func(opts k8sMeta.ListOptions) (watch.Interface, error) {
+			return kubeClient.CoreV1().Namespaces().Watch(ctx, opts)
+		},
+	}
+	_, controller := cache.NewInformer(watch, &k8sCore.Namespace{}, *flagResyncInterval, handler)
+	go controller.Run(nil)
+}
+
+// watchSelectedNamespaces calls start for each namespace as it starts matching
+// the label selector and stop as it stops matching or is deleted. Once the
+// returned hasSynced is true start has been called for every namespace
+// matching at first.
+func watchSelectedNamespaces(kubeClient kubernetes.Interface, selector string, start, stop func(ns string)) (hasSynced func() bool) {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*k8sCore.Namespace); ok {
+				fmt.Printf("namespace %s matches -namespace-selector, watching it\n", ns.Name)
+				start(ns.Name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			// The API server sends a delete once a namespace's labels stop
+			// matching the selector.
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*k8sCore.Namespace); ok {
+				stop(ns.Name)
+			}
+		},
+	}
+	watch := &cache.ListWatch{
+		ListFunc: func(opts k8sMeta.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return kubeClient.CoreV1().Namespaces().List(ctx, opts)
+		},
+		WatchFunc: func(opts k8sMeta.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return kubeClient.CoreV1().Namespaces().Watch(ctx, opts)
+		},
+	}
+	_, controller := cache.NewInformer(watch, &k8sCore.Namespace{}, *flagResyncInterval, handler)
+	go controller.Run(nil)
+	return controller.HasSynced
+}
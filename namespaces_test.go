@@ -0,0 +1,175 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	k8sCore "k8s.io/api/core/v1"
+	k8sNetworking "k8s.io/api/networking/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// setNamespace records ns as a watched Namespace object for the rest of the
+// test.
+func setNamespace(t *testing.T, ns *k8sCore.Namespace) {
+	t.Helper()
+	namespaceMeta.set(ns)
+	t.Cleanup(func() { namespaceMeta.delete(ns) })
+}
+
+func TestNamespaceLabelData(t *testing.T) {
+	setFlag(t, flagNamespaceLabelData, "team, cost_center, missing")
+	setNamespace(t, &k8sCore.Namespace{ObjectMeta: k8sMeta.ObjectMeta{
+		Name:   "apps",
+		Labels: map[string]string{"team": `platform"><script>`, "cost_center": "42", "unlisted": "x"},
+	}})
+
+	var ings []ingress
+	ings = append(ings, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	ings = append(ings, testEntries(t, testIngress("plain", "kibana", "kibana.example.com"))...)
+	_, srv := newTestServer(t, ings...)
+	_, body := get(t, srv, "/")
+
+	want := `data-team="platform&#34;&gt;&lt;script&gt;" data-cost-center="42"`
+	if strings.Count(body, want) != 1 {
+		t.Errorf("page is missing %s once for the labeled namespace", want)
+	}
+	for _, unwanted := range []string{"data-unlisted", "data-missing", `"><script>`} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("page contains %s", unwanted)
+		}
+	}
+}
+
+func TestSelectedNamespacesToggle(t *testing.T) {
+	setFlag(t, flagNamespaceSelector, "ingress-index=enabled")
+	labeled := func(name string) *k8sCore.Namespace {
+		return &k8sCore.Namespace{ObjectMeta: k8sMeta.ObjectMeta{Name: name, Labels: map[string]string{"ingress-index": "enabled"}}}
+	}
+	client := fake.NewSimpleClientset(
+		labeled("apps"),
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("ops", "kibana", "kibana.example.com"),
+	)
+	t.Cleanup(func() {
+		informers.remove("apps")
+		informers.remove("ops")
+	})
+	names := func(ings []ingress) string {
+		var out []string
+		for _, ing := range ings {
+			out = append(out, ing.key())
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+
+	captureOutput(t, func() {
+		respChan := startWatching(t, client)
+		waitForSnapshot(t, respChan, func(ings []ingress) bool { return names(ings) == "apps/grafana" })
+
+		// ops starts matching, its informer is started
+		if _, err := client.CoreV1().Namespaces().Create(ctx, labeled("ops"), k8sMeta.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForSnapshot(t, respChan, func(ings []ingress) bool { return names(ings) == "apps/grafana,ops/kibana" })
+
+		// apps stops matching, its informer is stopped and entries dropped
+		if err := client.CoreV1().Namespaces().Delete(ctx, "apps", k8sMeta.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForSnapshot(t, respChan, func(ings []ingress) bool { return names(ings) == "ops/kibana" })
+	})
+
+	if got := informers.watched(); !reflect.DeepEqual(got, []string{"ops"}) {
+		t.Errorf("watching %v, expected only ops", got)
+	}
+}
+
+func TestSortByNamespaceCount(t *testing.T) {
+	var ings []ingress
+	for ns, n := range map[string]int{"apps": 1, "data": 3, "ops": 2, "web": 2} {
+		for i := 0; i < n; i++ {
+			ings = append(ings, ingress{Namespace: ns, Name: fmt.Sprintf("app-%d", i)})
+		}
+	}
+	sortIngresses(ings)
+
+	for _, tc := range []struct {
+		sortBy string
+		order  []string
+	}{
+		{sortBy: sortByName, order: []string{"apps", "data", "ops", "web"}},
+		// ties are broken by name
+		{sortBy: sortByNamespaceCount, order: []string{"data", "ops", "web", "apps"}},
+	} {
+		setFlag(t, flagSortBy, tc.sortBy)
+
+		var order []string
+		for _, group := range (&namespaceIndex{}).groupByNamespace(ings) {
+			order = append(order, group.Namespace)
+		}
+		if !reflect.DeepEqual(order, tc.order) {
+			t.Errorf("-sort-by=%s: got %v, expected %v", tc.sortBy, order, tc.order)
+		}
+	}
+}
+
+func TestSections(t *testing.T) {
+	section := func(ns, name, value string) *k8sNetworking.Ingress {
+		ing := testIngress(ns, name, name+".example.com")
+		ing.Annotations = map[string]string{annotationSection: value}
+		return ing
+	}
+	var ings []ingress
+	for _, ing := range []*k8sNetworking.Ingress{
+		section("payments", "api", "Checkout"),
+		section("web", "storefront", " Checkout "),
+		section("ops", "blank", ""), // falls back to its namespace
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("apps", "kibana", "kibana.example.com"),
+		testIngress("payments", "ledger", "ledger.example.com"),
+	} {
+		ings = append(ings, testEntries(t, ing)...)
+	}
+	sortIngresses(ings)
+
+	expected := []string{
+		"apps: apps/grafana apps/kibana",
+		"ops: ops/blank",
+		"Checkout: payments/api web/storefront",
+		"payments: payments/ledger",
+	}
+	var got []string
+	for _, group := range (&namespaceIndex{}).groupByNamespace(ings) {
+		var keys []string
+		for _, ing := range group.Ingresses {
+			keys = append(keys, ing.key())
+		}
+		got = append(got, group.DisplayName+": "+strings.Join(keys, " "))
+		if (group.Section == "") == (group.Namespace == "") {
+			t.Errorf("%s: got section %q and namespace %q, expected only one", group.DisplayName, group.Section, group.Namespace)
+		}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got groups\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
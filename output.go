@@ -0,0 +1,259 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	k8sAuthorization "k8s.io/api/authorization/v1"
+	k8sCore "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of the -output-configmap the index is written to
+const (
+	outputKeyHTML = "index.html"
+	outputKeyJSON = "ingresses.json"
+)
+
+// configMapOutput writes the index into a ConfigMap when -output-configmap
+// is set
+var configMapOutput *configMapWriter
+
+// configMapWriter keeps the rendered index in a ConfigMap for other tools in
+// the cluster.
+type configMapWriter struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+
+	// render produces the page stored under outputKeyHTML
+	render func(ings []ingress) ([]byte, error)
+
+	// last is the data most recently written, to skip unchanged writes
+	last map[string]string
+}
+
+func newConfigMapWriter(client kubernetes.Interface, namespace, name string) *configMapWriter {
+	return &configMapWriter{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// watch writes each snapshot published on b, until b closes.
+func (c *configMapWriter) watch(b *broadcaster) {
+	updates := b.subscribe()
+	for ings := range updates {
+		if err := c.write(ings); err != nil {
+			fmt.Printf("ERROR: writing ConfigMap %s/%s, err=%v\n", c.namespace, c.name, err)
+		}
+	}
+}
+
+// write stores ings in the ConfigMap, patching only our keys so others are
+// left alone. The ConfigMap is created when it doesn't exist yet.
+func (c *configMapWriter) write(ings []ingress) error {
+	data, err := c.data(ings)
+	if err != nil {
+		return err
+	}
+	if sameData(c.last, data) {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+	configMaps := c.client.CoreV1().ConfigMaps(c.namespace)
+	_, err = configMaps.Patch(ctx, c.name, types.MergePatchType, patch, k8sMeta.PatchOptions{})
+	if k8sErrors.IsNotFound(err) {
+		cm := &k8sCore.ConfigMap{
+			ObjectMeta: k8sMeta.ObjectMeta{Namespace: c.namespace, Name: c.name},
+			Data:       data,
+		}
+		_, err = configMaps.Create(ctx, cm, k8sMeta.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	c.last = data
+	return nil
+}
+
+// data renders ings into the ConfigMap's keys.
+func (c *configMapWriter) data(ings []ingress) (map[string]string, error) {
+	if ings == nil {
+		ings = []ingress{} // encode as [] rather than null
+	}
+	bs, err := json.Marshal(ings)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{outputKeyJSON: string(bs)}
+	if c.render != nil {
+		page, err := c.render(ings)
+		if err != nil {
+			return nil, fmt.Errorf("rendering %s: %v", outputKeyHTML, err)
+		}
+		data[outputKeyHTML] = string(page)
+	}
+	return data, nil
+}
+
+func sameData(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// checkConfigMapAccess asks the API server if we're allowed to write the
+// -output-configmap, logging an actionable message for each missing
+// permission.
+func checkConfigMapAccess(c kubernetes.Interface, namespace, name string) {
+	for _, verb := range []string{"patch", "create"} {
+		attrs := &k8sAuthorization.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      verb,
+			Resource:  "configmaps",
+		}
+		if verb == "patch" {
+			attrs.Name = name // creating can't be limited to a name
+		}
+		review := &k8sAuthorization.SelfSubjectAccessReview{
+			Spec: k8sAuthorization.SelfSubjectAccessReviewSpec{ResourceAttributes: attrs},
+		}
+		resp, err := c.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, k8sMeta.CreateOptions{})
+		if err != nil {
+			fmt.Printf("unable to check %s access on ConfigMap %s/%s, err=%v\n", verb, namespace, name, err)
+			continue
+		}
+		if !resp.Status.Allowed {
+			fmt.Printf("ERROR: not allowed to %s ConfigMap %s/%s, grant %q on configmaps with a Role (reason: %s)\n", verb, namespace, name, verb, resp.Status.Reason)
+		}
+	}
+}
+
+// fileOutput writes the index to a file when -snapshot-file is set
+var fileOutput *fileWriter
+
+// fileWriter keeps the rendered index in a file for another web server to
+// serve.
+type fileWriter struct {
+	path     string
+	interval time.Duration
+
+	// render produces the page written to path
+	render func(ings []ingress) ([]byte, error)
+
+	// last is the page most recently written, to skip writing it again
+	// after a change which doesn't affect it
+	last []byte
+}
+
+func newFileWriter(path string, interval time.Duration) *fileWriter {
+	return &fileWriter{
+		path:     path,
+		interval: interval,
+	}
+}
+
+// watch writes the index each time a snapshot is published on b, and every
+// interval when it's set so time dependent parts of the page stay current,
+// until b closes.
+func (f *fileWriter) watch(b *broadcaster, current func() []ingress) {
+	updates := b.subscribe()
+
+	var tick <-chan time.Time
+	if f.interval > 0 {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var (
+			ings    []ingress
+			rewrite bool
+		)
+		select {
+		case cur, ok := <-updates:
+			if !ok {
+				return
+			}
+			ings = cur
+		case <-tick:
+			ings, rewrite = current(), true
+		}
+		if err := f.write(ings, rewrite); err != nil {
+			fmt.Printf("ERROR: writing -snapshot-file %s, err=%v\n", f.path, err)
+		}
+	}
+}
+
+// write renders ings into the file, unless the page is unchanged and rewrite
+// isn't set. The page is written to a temporary file in the same directory
+// and renamed over the old one, so readers only ever see a complete page.
+func (f *fileWriter) write(ings []ingress, rewrite bool) error {
+	page, err := f.render(ings)
+	if err != nil {
+		return fmt.Errorf("rendering: %v", err)
+	}
+	if !rewrite && f.last != nil && bytes.Equal(f.last, page) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+
+	if _, err := tmp.Write(page); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	f.last = page
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	k8sCore "k8s.io/api/core/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapWriter(t *testing.T) {
+	existing := &k8sCore.ConfigMap{
+		ObjectMeta: k8sMeta.ObjectMeta{Namespace: "tools", Name: "index"},
+		Data:       map[string]string{"owner": "platform"},
+	}
+	cases := []struct {
+		name    string
+		objects []k8sCore.ConfigMap
+	}{
+		{"patches existing", []k8sCore.ConfigMap{*existing}},
+		{"creates missing", nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			for i := range tc.objects {
+				client.Tracker().Add(&tc.objects[i])
+			}
+			w := newConfigMapWriter(client, "tools", "index")
+			w.render = func(ings []ingress) ([]byte, error) {
+				var names []string
+				for _, ing := range ings {
+					names = append(names, ing.Name)
+				}
+				return []byte("<ul>" + strings.Join(names, ",") + "</ul>"), nil
+			}
+			get := func() map[string]string {
+				cm, err := client.CoreV1().ConfigMaps("tools").Get(ctx, "index", k8sMeta.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return cm.Data
+			}
+
+			grafana := testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))
+			if err := w.write(grafana); err != nil {
+				t.Fatal(err)
+			}
+			data := get()
+			if data[outputKeyHTML] != "<ul>grafana</ul>" {
+				t.Errorf("got %s %q", outputKeyHTML, data[outputKeyHTML])
+			}
+			if !strings.Contains(data[outputKeyJSON], `"fqdn":"http://grafana.example.com"`) {
+				t.Errorf("got %s %q", outputKeyJSON, data[outputKeyJSON])
+			}
+
+			both := append(grafana, testEntries(t, testIngress("apps", "kibana", "kibana.example.com"))...)
+			if err := w.write(both); err != nil {
+				t.Fatal(err)
+			}
+			data = get()
+			if data[outputKeyHTML] != "<ul>grafana,kibana</ul>" {
+				t.Errorf("after a change, got %s %q", outputKeyHTML, data[outputKeyHTML])
+			}
+			if !strings.Contains(data[outputKeyJSON], `"fqdn":"http://kibana.example.com"`) {
+				t.Errorf("after a change, got %s %q", outputKeyJSON, data[outputKeyJSON])
+			}
+			if len(tc.objects) > 0 && data["owner"] != "platform" {
+				t.Error("keys we don't own were dropped")
+			}
+
+			writes := len(client.Actions())
+			if err := w.write(both); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(client.Actions()); n != writes {
+				t.Errorf("an unchanged index made %d more requests", n-writes)
+			}
+		})
+	}
+}
+
+func TestFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.html")
+	f := newFileWriter(path, time.Minute)
+	f.render = func(ings []ingress) ([]byte, error) {
+		return []byte(fmt.Sprintf("%d ingresses", len(ings))), nil
+	}
+	one := []ingress{{Name: "grafana"}}
+
+	var previous os.FileInfo
+	for _, tc := range []struct {
+		name     string
+		ings     []ingress
+		rewrite  bool
+		replaced bool
+	}{
+		{name: "first", ings: one, replaced: true},
+		{name: "unchanged", ings: one},
+		{name: "changed", ings: append(one, ingress{Name: "kibana"}), replaced: true},
+		{name: "interval", ings: append(one, ingress{Name: "kibana"}), rewrite: true, replaced: true},
+	} {
+		if err := f.write(tc.ings, tc.rewrite); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		// a new file is renamed over the old one rather than writing to it
+		if replaced := previous == nil || !os.SameFile(previous, info); replaced != tc.replaced {
+			t.Errorf("%s: got replaced=%v, expected %v", tc.name, replaced, tc.replaced)
+		}
+		if info.Mode().Perm() != 0o644 {
+			t.Errorf("%s: got mode %v, expected 0644", tc.name, info.Mode())
+		}
+		if page, _ := os.ReadFile(path); string(page) != fmt.Sprintf("%d ingresses", len(tc.ings)) {
+			t.Errorf("%s: got page %q", tc.name, page)
+		}
+		previous = info
+	}
+
+	// the temporary files are written next to the page, and none are left
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "index.html" {
+		t.Errorf("got %v in the directory, expected only index.html", entries)
+	}
+	missing := newFileWriter(filepath.Join(dir, "missing", "index.html"), 0)
+	missing.render = f.render
+	if err := missing.write(nil, false); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+
+	f.render = func(ings []ingress) ([]byte, error) { return nil, errors.New("boom") }
+	if err := f.write(one, true); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("got %v rendering, expected the error", err)
+	}
+	if page, _ := os.ReadFile(path); string(page) != "2 ingresses" {
+		t.Errorf("a failed render left %q", page)
+	}
+}
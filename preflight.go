@@ -0,0 +1,63 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	k8sAuthorization "k8s.io/api/authorization/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkIngressAccess asks the API server if we're allowed to list and watch
+// Ingresses in each namespace. Watches fail quietly without these permissions
+// so an actionable message is logged for each one that's missing.
+func checkIngressAccess(c kubernetes.Interface, namespaces []string) {
+	for _, ns := range namespaces {
+		for _, verb := range []string{"list", "watch"} {
+			review := &k8sAuthorization.SelfSubjectAccessReview{
+				Spec: k8sAuthorization.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &k8sAuthorization.ResourceAttributes{
+						Namespace: ns,
+						Verb:      verb,
+						Group:     "networking.k8s.io",
+						Resource:  "ingresses",
+					},
+				},
+			}
+			resp, err := c.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, k8sMeta.CreateOptions{})
+			if err != nil {
+				fmt.Printf("unable to check %s access on Ingresses in namespace %s, err=%v\n", verb, ns, err)
+				continue
+			}
+			if !resp.Status.Allowed {
+				fmt.Printf("ERROR: not allowed to %s Ingresses in namespace %s, grant %q on ingresses.networking.k8s.io with a Role or ClusterRole (reason: %s)\n", verb, ns, verb, resp.Status.Reason)
+			}
+		}
+	}
+}
+
+// checkIngressList tries listing Ingresses in ns, returning an error only if
+// we're forbidden from doing so. Other failures are left for the informer to
+// retry.
+func checkIngressList(c kubernetes.Interface, ns string) error {
+	_, err := c.NetworkingV1().Ingresses(ns).List(ctx, k8sMeta.ListOptions{Limit: 1})
+	if k8sErrors.IsForbidden(err) {
+		return err
+	}
+	return nil
+}
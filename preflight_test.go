@@ -0,0 +1,90 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+// failList has client fail to list the Ingresses of namespace ns with err.
+func failList(client *fake.Clientset, ns string, err error) {
+	client.PrependReactor("list", "ingresses", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != ns {
+			return false, nil, nil
+		}
+		return true, nil, err
+	})
+}
+
+var errForbidden = k8sErrors.NewForbidden(schema.GroupResource{Group: "networking.k8s.io", Resource: "ingresses"}, "", errors.New("RBAC: access denied"))
+
+func TestCheckIngressList(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		listErr error
+		skip    bool
+	}{
+		{name: "allowed"},
+		{name: "forbidden", listErr: errForbidden, skip: true},
+		{name: "unavailable", listErr: k8sErrors.NewServiceUnavailable("try again"), skip: false}, // left to the informer to retry
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if tc.listErr != nil {
+				failList(client, "apps", tc.listErr)
+			}
+			if err := checkIngressList(client, "apps"); (err != nil) != tc.skip {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestWatchSkipsForbiddenNamespace(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("secret", "vault", "vault.example.com"),
+	)
+	failList(client, "secret", errForbidden)
+
+	var respChan chan []ingress
+	out := captureOutput(t, func() {
+		respChan = startWatching(t, client, "apps", "secret")
+		waitForSnapshot(t, respChan, func(ings []ingress) bool { return len(ings) == 1 })
+	})
+
+	status := informers.status(nil)
+	if st := status["secret"]; st.Skipped == "" {
+		t.Errorf("got secret %+v, expected it to be skipped", st)
+	}
+	if st, ok := status["apps"]; !ok || st.Skipped != "" {
+		t.Errorf("got apps %+v, expected it to be watched", st)
+	}
+	if !strings.Contains(out, "ERROR: skipping namespace secret") {
+		t.Errorf("got %q, expected an error about skipping secret", out)
+	}
+	if got := informers.watched(); !reflect.DeepEqual(got, []string{"apps"}) {
+		t.Errorf("watching %v, expected only apps", got)
+	}
+}
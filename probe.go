@@ -0,0 +1,185 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reachability of an Ingress's FQDN, also used as a CSS class suffix.
+const (
+	statusUp      = "up"
+	statusDown    = "down"
+	statusUnknown = "unknown"
+)
+
+var (
+	// how many FQDNs are probed at once
+	probeConcurrency = 10
+)
+
+// prober periodically checks if each FQDN responds.
+type prober struct {
+	client   *http.Client
+	statuses map[string]string
+	mu       sync.RWMutex
+}
+
+func newProber(timeout time.Duration) *prober {
+	return &prober{
+		client: &http.Client{
+			Timeout: timeout,
+			// a redirect still means something answered
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		statuses: make(map[string]string),
+	}
+}
+
+// status returns the last probe result for the URL target.
+func (p *prober) status(target string) string {
+	if p == nil {
+		return statusUnknown
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if s, ok := p.statuses[target]; ok {
+		return s
+	}
+	return statusUnknown
+}
+
+// healthSummary counts the probed backends by reachability, for alerting.
+type healthSummary struct {
+	Up      int `json:"up"`
+	Down    int `json:"down"`
+	Unknown int `json:"unknown"`
+
+	// DownFQDNs are the FQDNs of the entries whose backend is down
+	DownFQDNs []string `json:"downFqdns"`
+}
+
+// summarize counts the backends of ings by their last probe result. Entries
+// sharing a probe URL count once. Without a prober everything is unknown.
+func (p *prober) summarize(ings []ingress) healthSummary {
+	out := healthSummary{DownFQDNs: []string{}}
+	if p != nil {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+	}
+
+	counted := make(map[string]bool)
+	down := make(map[string]bool)
+	for i := range ings {
+		target := ings[i].probeURL()
+		status := statusUnknown
+		if p != nil && !ings[i].skipProbe {
+			if s, ok := p.statuses[target]; ok {
+				status = s
+			}
+		}
+		if status == statusDown && !down[ings[i].FQDN] {
+			down[ings[i].FQDN] = true
+			out.DownFQDNs = append(out.DownFQDNs, ings[i].FQDN)
+		}
+		if counted[target] {
+			continue
+		}
+		counted[target] = true
+		switch status {
+		case statusUp:
+			out.Up++
+		case statusDown:
+			out.Down++
+		default:
+			out.Unknown++
+		}
+	}
+	sort.Strings(out.DownFQDNs)
+	return out
+}
+
+// serveHealthSummary responds with the reachability of the current
+// Ingresses of sites for the Host of the request, as probed by reachability,
+// as JSON.
+func serveHealthSummary(sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reachability.summarize(sites.forRequest(r).apply(current())))
+	}
+}
+
+// run probes the current Ingresses every interval, it never returns.
+func (p *prober) run(interval time.Duration, current func() []ingress) {
+	for {
+		p.probeAll(current())
+		time.Sleep(interval)
+	}
+}
+
+func (p *prober) probeAll(ings []ingress) {
+	results := make(map[string]string, len(ings))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeConcurrency)
+	for i := range ings {
+		if ings[i].skipProbe {
+			continue
+		}
+		target := ings[i].probeURL()
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			s := p.probe(target)
+			mu.Lock()
+			results[target] = s
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// replace wholesale so removed Ingresses are forgotten
+	p.mu.Lock()
+	p.statuses = results
+	p.mu.Unlock()
+}
+
+// probe sends a HEAD request to target. Any response below 500 counts as up.
+func (p *prober) probe(target string) string {
+	req, err := http.NewRequest(http.MethodHead, target, nil)
+	if err != nil {
+		return statusUnknown
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		fmt.Printf("probe of %s failed, err=%v\n", target, err)
+		return statusDown
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return statusDown
+	}
+	return statusUp
+}
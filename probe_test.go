@@ -0,0 +1,188 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// probedPaths serves the health of a backend where /healthz fails, recording
+// the paths probed.
+type probedPaths struct {
+	paths []string
+	mu    sync.Mutex
+}
+
+func (p *probedPaths) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.paths = append(p.paths, r.URL.Path)
+	p.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/healthz":
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case "/moved":
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+func (p *probedPaths) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := p.paths
+	p.paths = nil
+	return out
+}
+
+func TestProbeHealthPath(t *testing.T) {
+	backend := &probedPaths{}
+	ts := httptest.NewServer(backend)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		healthPath string
+		probed     string
+		status     string
+	}{
+		{healthPath: "", probed: "/", status: statusUp},
+		{healthPath: "/ready", probed: "/ready", status: statusUp},
+		{healthPath: "/healthz", probed: "/healthz", status: statusDown},
+		{healthPath: "/moved", probed: "/moved", status: statusUp}, // redirects aren't followed
+		{healthPath: "healthz", probed: "/", status: statusUp},     // not absolute, ignored
+	} {
+		ing := testIngress("apps", "web", "web.example.com")
+		if tc.healthPath != "" {
+			ing.Annotations = map[string]string{annotationHealthPath: tc.healthPath}
+		}
+		var entries []ingress
+		captureOutput(t, func() { entries = testEntries(t, ing) })
+		entries[0].FQDN = ts.URL // probe the test server rather than the host
+
+		p := newProber(time.Second)
+		p.probeAll(entries)
+		if got := backend.take(); len(got) != 1 || got[0] != tc.probed {
+			t.Errorf("health path %q: probed %v, expected %s", tc.healthPath, got, tc.probed)
+		}
+		if got := p.status(entries[0].probeURL()); got != tc.status {
+			t.Errorf("health path %q: got status %s, expected %s", tc.healthPath, got, tc.status)
+		}
+	}
+}
+
+func TestHealthSummary(t *testing.T) {
+	var ings []ingress
+	for _, ing := range []*k8sNetworking.Ingress{
+		testIngress("apps", "grafana", "grafana.example.com"),
+		testIngress("apps", "kibana", "kibana.example.com"),
+		testIngress("ops", "kibana", "kibana.example.com"), // the same backend
+		testIngress("apps", "loki", "loki.example.com"),
+		testIngress("apps", "tempo", "tempo.example.com"),
+	} {
+		ings = append(ings, testEntries(t, ing)...)
+	}
+
+	p := &prober{statuses: map[string]string{
+		"http://grafana.example.com": statusUp,
+		"http://kibana.example.com":  statusDown,
+		"http://loki.example.com":    statusDown,
+		// tempo hasn't been probed yet
+	}}
+	expected := healthSummary{
+		Up:        1,
+		Down:      2,
+		Unknown:   1,
+		DownFQDNs: []string{"http://kibana.example.com", "http://loki.example.com"},
+	}
+	if got := p.summarize(ings); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+
+	setFlag(t, &reachability, p)
+	_, body := get(t, serveHealthSummary(nil, func() []ingress { return ings }), "/healthsummary.json")
+	var served healthSummary
+	if err := json.Unmarshal([]byte(body), &served); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(served, expected) {
+		t.Errorf("/healthsummary.json got %+v, expected %+v", served, expected)
+	}
+
+	// without -probe-interval nothing is known
+	var off *prober
+	if got := off.summarize(ings); got.Unknown != 4 || got.Up != 0 || got.Down != 0 || len(got.DownFQDNs) != 0 {
+		t.Errorf("without a prober got %+v", got)
+	}
+}
+
+func TestSkipHealthCheck(t *testing.T) {
+	backend := &probedPaths{}
+	ts := httptest.NewServer(backend)
+	defer ts.Close()
+
+	var entries []ingress
+	for _, tc := range []struct {
+		name, path, skip string
+	}{
+		{name: "probed", path: "/probed"},
+		{name: "excluded", path: "/excluded", skip: "true"},
+		{name: "not-excluded", path: "/not-excluded", skip: "false"},
+	} {
+		ing := testIngress("apps", tc.name, tc.name+".example.com")
+		ing.Annotations = map[string]string{annotationHealthPath: tc.path}
+		if tc.skip != "" {
+			ing.Annotations[annotationSkipHealth] = tc.skip
+		}
+		entry := testEntries(t, ing)[0]
+		entry.FQDN = ts.URL // probe the test server rather than the host
+		entries = append(entries, entry)
+	}
+
+	p := newProber(time.Second)
+	for i := 0; i < 3; i++ {
+		p.probeAll(entries)
+	}
+	probed := make(map[string]int)
+	for _, path := range backend.take() {
+		probed[path]++
+	}
+	if probed["/excluded"] != 0 {
+		t.Errorf("the excluded Ingress was probed %d times", probed["/excluded"])
+	}
+	if probed["/probed"] != 3 || probed["/not-excluded"] != 3 {
+		t.Errorf("got probes %v, expected 3 each of the others", probed)
+	}
+
+	// even when another entry shares its probe URL, an excluded one stays unknown
+	p.statuses[entries[1].probeURL()] = statusUp
+	setFlag(t, &reachability, p)
+	for _, ing := range decorateIngresses(entries) {
+		expected := statusUp
+		if ing.Name == "excluded" {
+			expected = statusUnknown
+		}
+		if ing.Status != expected {
+			t.Errorf("%s: got status %s, expected %s", ing.Name, ing.Status, expected)
+		}
+	}
+}
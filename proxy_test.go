@@ -0,0 +1,80 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternalURL(t *testing.T) {
+	networks, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		host       string
+		expected   string
+	}{
+		{"trusted network", "10.1.2.3:4567", "https", "index.example.com", "https://index.example.com/ingresses/"},
+		{"trusted address", "192.168.1.5:4567", "https", "index.example.com", "https://index.example.com/ingresses/"},
+		{"trusted, several proxies", "10.1.2.3:4567", "HTTPS, http", "index.example.com, proxy.internal", "https://index.example.com/ingresses/"},
+		{"trusted, bad scheme", "10.1.2.3:4567", "gopher", "", "http://internal:8080/ingresses/"},
+		{"trusted, no headers", "10.1.2.3:4567", "", "", "http://internal:8080/ingresses/"},
+		{"untrusted", "203.0.113.9:4567", "https", "evil.example.com", "http://internal:8080/ingresses/"},
+		{"untrusted, next door", "192.168.1.6:4567", "https", "evil.example.com", "http://internal:8080/ingresses/"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://internal:8080/ingresses/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			if tc.host != "" {
+				r.Header.Set("X-Forwarded-Host", tc.host)
+			}
+			if got := externalURL(networks, r, "/ingresses/"); got != tc.expected {
+				t.Errorf("got %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	cases := []struct {
+		in    string
+		count int
+		err   bool
+	}{
+		{"", 0, false},
+		{"10.0.0.0/8", 1, false},
+		{"10.0.0.0/8,fd00::/8, 127.0.0.1 ,::1", 4, false},
+		{"10.0.0.0/33", 0, true},
+		{"proxy.internal", 0, true},
+	}
+	for _, tc := range cases {
+		networks, err := parseTrustedProxies(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: got error %v, expected error=%v", tc.in, err, tc.err)
+		}
+		if len(networks) != tc.count {
+			t.Errorf("%q: got %d networks, expected %d", tc.in, len(networks), tc.count)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// parseSecretRef splits a -namespaces-secret reference of the form
+// namespace/name#key.
+func parseSecretRef(ref string) (ns, name, key string, err error) {
+	object, key, ok := strings.Cut(ref, "#")
+	if ok {
+		ns, name, ok = strings.Cut(object, "/")
+	}
+	if !ok || ns == "" || name == "" || key == "" || strings.Contains(name, "/") {
+		return "", "", "", fmt.Errorf("invalid secret reference %q, expected namespace/name#key", ref)
+	}
+	return ns, name, key, nil
+}
+
+// secretNamespaces reads the comma separated namespaces stored under a key
+// of the Secret referenced by ref. The API server has already decoded the
+// base64 of the Secret's data.
+func secretNamespaces(c kubernetes.Interface, ref string) ([]string, error) {
+	ns, name, key, err := parseSecretRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := c.CoreV1().Secrets(ns).Get(ctx, name, k8sMeta.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("secret %s/%s not found", ns, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secret %s/%s: %v", ns, name, err)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %q", ns, name, key)
+	}
+	return parseList(string(value)), nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	k8sCore "k8s.io/api/core/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	for _, tc := range []struct {
+		ref           string
+		ns, name, key string
+		err           bool
+	}{
+		{ref: "tools/index#namespaces", ns: "tools", name: "index", key: "namespaces"},
+		{ref: "tools/index", err: true},
+		{ref: "index#namespaces", err: true},
+		{ref: "index", err: true},
+		{ref: "", err: true},
+		{ref: "/index#namespaces", err: true},
+		{ref: "tools/#namespaces", err: true},
+		{ref: "tools/index#", err: true},
+		{ref: "tools/index/extra#namespaces", err: true},
+		{ref: "tools//index#namespaces", err: true},
+	} {
+		ns, name, key, err := parseSecretRef(tc.ref)
+		if tc.err {
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid secret reference") {
+				t.Errorf("%q: got %s/%s#%s, expected an error", tc.ref, ns, name, key)
+			}
+			continue
+		}
+		if err != nil || ns != tc.ns || name != tc.name || key != tc.key {
+			t.Errorf("%q: got %s/%s#%s err=%v, expected %s/%s#%s", tc.ref, ns, name, key, err, tc.ns, tc.name, tc.key)
+		}
+	}
+}
+
+func TestSecretNamespaces(t *testing.T) {
+	client := fake.NewSimpleClientset(&k8sCore.Secret{
+		ObjectMeta: k8sMeta.ObjectMeta{Namespace: "tools", Name: "index"},
+		Data:       map[string][]byte{"namespaces": []byte("apps, ops")},
+	})
+	for _, tc := range []struct {
+		ref        string
+		namespaces []string
+		err        string
+	}{
+		{ref: "tools/index#namespaces", namespaces: []string{"apps", "ops"}},
+		{ref: "tools/index#other", err: `secret tools/index has no key "other"`},
+		{ref: "tools/missing#namespaces", err: "secret tools/missing not found"},
+		{ref: "tools/index", err: "invalid secret reference"},
+	} {
+		namespaces, err := secretNamespaces(client, tc.ref)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("%q: got %v err=%v, expected %q", tc.ref, namespaces, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(namespaces, tc.namespaces) {
+			t.Errorf("%q: got %v err=%v, expected %v", tc.ref, namespaces, err, tc.namespaces)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// index holds the Ingresses currently being served.
+type index struct {
+	ingresses []ingress
+	events    *broadcaster
+	mu        sync.RWMutex
+
+	// slugs map each slug to the link /go/<slug> redirects to, collisions
+	// are the slugs claimed by several Ingresses
+	slugs      map[string]string
+	collisions map[string][]string
+}
+
+func newIndex() *index {
+	return &index{
+		events: &broadcaster{},
+	}
+}
+
+// current returns the latest snapshot of Ingresses, which mustn't be modified.
+func (idx *index) current() []ingress {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.ingresses
+}
+
+// slug returns the link which /go/<slug> redirects to.
+func (idx *index) slug(slug string) (string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	target, ok := idx.slugs[slug]
+	return target, ok
+}
+
+// set replaces the snapshot of Ingresses and notifies /events subscribers.
+func (idx *index) set(ings []ingress) {
+	sortIngresses(ings)
+
+	slugs, collisions := slugTargets(ings)
+
+	idx.mu.Lock()
+	warnSlugCollisions(idx.collisions, collisions)
+	idx.ingresses = ings
+	idx.slugs = slugs
+	idx.collisions = collisions
+	idx.mu.Unlock()
+
+	idx.events.publish(ings)
+}
+
+// server is the handler for every page and endpoint, along with what it
+// loaded that the rest of the process needs. Nothing is kept in package
+// variables, so several can be built side by side, e.g. in tests.
+type server struct {
+	http.Handler
+
+	// sites are the filters of -host-filters, nil when unset
+	sites *hostFilters
+
+	// templates are the page templates read from disk, for reloading
+	templates *templateSets
+
+	// render renders the default theme for the outputs, which aren't served
+	// from a request so links back to the index are relative to -base-path
+	render func(ings []ingress) ([]byte, error)
+}
+
+// newHandler builds the server for every page and endpoint, serving the
+// Ingresses held in idx.
+func newHandler(idx *index) (*server, error) {
+	basePath := cleanBasePath(*flagBasePath)
+	mux := http.NewServeMux()
+
+	footer, err := loadFooter(*flagFooterHTML, *flagFooterTrusted)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -footer-html, err=%v", err)
+	}
+	stylesheet, err := loadStylesheet(*flagStylesheet)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -stylesheet, err=%v", err)
+	}
+
+	robots, err := loadRobots(*flagRobotsTxt)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -robots-txt, err=%v", err)
+	}
+	adminToken, err := loadAdminToken(*flagAdminToken)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -admin-token, err=%v", err)
+	}
+	if *flagAdmin && adminToken == "" {
+		return nil, fmt.Errorf("-admin requires -admin-token")
+	}
+	sites, err := loadHostFilters(*flagHostFilters)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -host-filters, err=%v", err)
+	}
+
+	// handle registers h on path and redirects the trailing slash form of
+	// path to it, so both spellings of a route agree.
+	handle := func(path string, h http.HandlerFunc) {
+		mux.HandleFunc(path, h)
+		if strings.HasSuffix(path, "/") {
+			return // http.ServeMux redirects path without the slash already
+		}
+		mux.HandleFunc(path+"/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != path+"/" {
+				http.NotFound(w, r)
+				return
+			}
+			target := externalURL(trustedProxies, r, basePath) + path
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		})
+	}
+
+	// newPageData returns what pages listing ings are rendered with.
+	newPageData := func(ings []ingress, baseURL string) pageData {
+		data := pageData{
+			Ingresses:    decorateIngresses(ings),
+			BasePath:     basePath,
+			BaseURL:      baseURL,
+			EmptyMessage: *flagEmptyMessage,
+			EmptyLink:    *flagEmptyLink,
+			Stylesheet:   stylesheet,
+			Footer:       footer,
+		}
+		if maintenance.active() {
+			data.Maintenance = *flagMaintenanceMessage
+			for i := range data.Ingresses {
+				data.Ingresses[i].Disabled = *flagMaintenanceLinks
+			}
+		}
+		return data
+	}
+
+	// loading is served by the pages during -warmup.
+	loadingPage, err := template.ParseFS(webFS, "web/loading.html")
+	if err != nil {
+		return nil, fmt.Errorf("error loading the loading page, err=%v", err)
+	}
+	loading := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		loadingPage.Execute(w, pageData{
+			BasePath:   basePath,
+			BaseURL:    externalURL(trustedProxies, r, basePath),
+			Stylesheet: stylesheet,
+		})
+	}
+
+	// page renders a template from tpls, limited to Ingresses created within
+	// since when it's non-zero. The ?since= query parameter overrides it.
+	page := func(tpls *pageTemplates, since time.Duration) http.HandlerFunc {
+		return warmup(informers, *flagWarmup, loading, func(w http.ResponseWriter, r *http.Request) {
+			tpl := tpls.pick(w, r)
+			since, err := sinceParam(r, since)
+			if err != nil {
+				http.Error(w, "400 bad request: invalid since duration", http.StatusBadRequest)
+				return
+			}
+			ings := sites.forRequest(r).apply(idx.current())
+			if since > 0 {
+				ings = createdSince(ings, time.Now().Add(-since))
+			}
+			data := newPageData(ings, externalURL(trustedProxies, r, basePath))
+			data.Since = since
+			var buf bytes.Buffer
+			if err := tpl.Execute(&buf, data); err != nil {
+				http.Error(w, "500 internal server error", http.StatusInternalServerError)
+				return
+			}
+			writePage(w, r, buf.Bytes())
+		})
+	}
+
+	routes, err := parseTemplateRoutes(*flagTemplateRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing -template-routes, err=%v", err)
+	}
+	themed, err := loadThemes(*flagDefaultTheme, *flagTemplate, basePath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading templates, err=%v", err)
+	}
+	srv := &server{
+		sites:     sites,
+		templates: &templateSets{},
+		render: func(ings []ingress) ([]byte, error) {
+			var buf bytes.Buffer
+			tpl, _ := themed.get(themed.defaultTheme)
+			err := tpl.Execute(&buf, newPageData(ings, basePath))
+			return buf.Bytes(), err
+		},
+	}
+	srv.templates.add(themed)
+	for path, file := range routes {
+		tpl, err := loadTemplate(file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading template for %s, err=%v", path, err)
+		}
+		routed := singleTemplate(file, tpl)
+		srv.templates.add(routed)
+		handle(path, page(routed, 0))
+	}
+	if _, ok := routes["/"]; !ok {
+		handle("/", page(themed, 0))
+	}
+	if _, ok := routes["/new"]; !ok {
+		handle("/new", page(themed, *flagNewWindow))
+	}
+
+	handle("/export.csv", serveCSV(sites, idx.current))
+	handle("/export.jsonl", serveJSONLines(sites, idx.current))
+	handle("/api/ingresses", apiCache(serveIngresses(sites, idx.current)))
+	handle("/api/live", apiCache(serveLive(informers, sites, idx.current)))
+	handle("/api/summary", apiCache(serveSummary(sites, idx.current)))
+	handle("/healthsummary.json", apiCache(serveHealthSummary(sites, idx.current)))
+	handle("/api/namespaces", apiCache(serveNamespaces(informers, sites, idx.current)))
+	handle("/go/", serveSlug(sites, idx.slug, idx.current))
+	handle("/events", serveEvents(idx.events, sites, idx.current))
+	handle("/metrics", serveMetrics)
+	handle("/debug/namespaces", serveNamespaceStatus(informers, idx.current))
+	handle("/debug/conflicts", serveConflicts(sites, idx.current))
+	handle("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	handle("/readyz", serveReady(informers, idx.current, *flagMinReadyIngresses))
+	if adminToken != "" {
+		handle("/admin/maintenance", serveMaintenance(maintenance, adminToken))
+		if *flagAdmin {
+			handle("/admin/config", serveConfig(liveConfig, adminToken))
+		}
+	}
+	handle("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(robots)
+	})
+	handle("/favicon.svg", func(w http.ResponseWriter, r *http.Request) {
+		favicon, _ := webFS.ReadFile("web/favicon.svg")
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(favicon)
+	})
+
+	srv.Handler = mux
+	if basePath != "" {
+		srv.Handler = withBasePath(basePath, mux)
+	}
+	return srv, nil
+}
@@ -0,0 +1,529 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// get requests path from h, returning the response and its body.
+func get(t *testing.T, h http.Handler, path string) (*http.Response, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	res := rec.Result()
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body)
+}
+
+// newTestServer returns a handler serving ings.
+func newTestServer(t *testing.T, ings ...ingress) (*index, *server) {
+	t.Helper()
+	idx := newIndex()
+	idx.set(ings)
+	srv, err := newHandler(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx, srv
+}
+
+func TestHandlerLinks(t *testing.T) {
+	var ings []ingress
+	ings = append(ings, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	ings = append(ings, testEntries(t, testIngress("apps", "kibana", "kibana.example.com"))...)
+	_, srv := newTestServer(t, ings...)
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", res.StatusCode)
+	}
+	for _, want := range []string{`href="http://grafana.example.com"`, `href="http://kibana.example.com"`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("page is missing %s", want)
+		}
+	}
+}
+
+func TestHandlerIndependent(t *testing.T) {
+	_, a := newTestServer(t, testEntries(t, testIngress("apps", "a", "a.example.com"))...)
+	_, b := newTestServer(t)
+
+	if _, body := get(t, a, "/"); !strings.Contains(body, "a.example.com") {
+		t.Error("first handler is missing its Ingress")
+	}
+	if _, body := get(t, b, "/"); strings.Contains(body, "a.example.com") {
+		t.Error("second handler shows the first handler's Ingress")
+	}
+	if len(a.templates.sets) != 1 || len(b.templates.sets) != 1 {
+		t.Errorf("got %d and %d template sets, expected 1 each", len(a.templates.sets), len(b.templates.sets))
+	}
+}
+
+func TestShowAnnotations(t *testing.T) {
+	setFlag(t, flagShowAnnotations, true)
+	setFlag(t, flagMaxAnnotationLength, 10)
+
+	ing := testIngress("apps", "web", "web.example.com")
+	ing.Annotations = map[string]string{
+		"example.com/<owner>":                              "<script>alert(1)</script>",
+		"kubectl.kubernetes.io/last-applied-configuration": `{"kind":"Ingress"}`,
+	}
+	_, srv := newTestServer(t, testEntries(t, ing)...)
+
+	for _, theme := range []string{"default", "grouped", "dense"} {
+		_, body := get(t, srv, "/?theme="+theme)
+		if strings.Contains(body, "<script>al") || strings.Contains(body, "<owner>") {
+			t.Errorf("%s: annotations aren't escaped", theme)
+		}
+		if !strings.Contains(body, "example.com/&lt;owner&gt;") {
+			t.Errorf("%s: annotation key is missing", theme)
+		}
+		if !strings.Contains(body, "&lt;script&gt;al…") {
+			t.Errorf("%s: annotation value isn't cut to -max-annotation-length", theme)
+		}
+		if strings.Contains(body, "last-applied-configuration") {
+			t.Errorf("%s: last-applied-configuration is shown", theme)
+		}
+	}
+
+	setFlag(t, flagShowAnnotations, false)
+	_, srv = newTestServer(t, testEntries(t, ing)...)
+	if _, body := get(t, srv, "/"); strings.Contains(body, "owner") {
+		t.Error("annotations are shown without -show-annotations")
+	}
+}
+
+func TestTemplateRoutes(t *testing.T) {
+	exec := writeTempFile(t, "exec.html", `exec:{{range .Ingresses}} {{.FQDN}}{{end}}`)
+	ops := writeTempFile(t, "ops.html", `ops:{{range .Ingresses}} {{.Name}}{{end}}`)
+	setFlag(t, flagTemplateRoutes, "/exec="+exec+", /ops="+ops)
+
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+
+	for _, tc := range []struct {
+		path string
+		body string
+	}{
+		{path: "/exec", body: "exec: http://grafana.example.com"},
+		{path: "/ops", body: "ops: grafana"},
+	} {
+		res, body := get(t, srv, tc.path)
+		if res.StatusCode != http.StatusOK || body != tc.body {
+			t.Errorf("%s: got %d %q, expected %q", tc.path, res.StatusCode, body, tc.body)
+		}
+	}
+	if _, body := get(t, srv, "/"); !strings.Contains(body, `href="http://grafana.example.com"`) {
+		t.Error("/ isn't rendered with the default theme")
+	}
+
+	// routes the mux would panic on are an error instead
+	for _, routes := range []string{"/metrics=" + exec, "/exec=" + exec + ",/exec/=" + ops} {
+		setFlag(t, flagTemplateRoutes, routes)
+		if _, err := newHandler(newIndex()); err == nil {
+			t.Errorf("-template-routes=%s: expected an error", routes)
+		}
+	}
+}
+
+func TestParseTemplateRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		routes map[string]string
+		err    bool
+	}{
+		{in: "", routes: map[string]string{}},
+		{in: "/exec=exec.html, /=index.html", routes: map[string]string{"/exec": "exec.html", "/": "index.html"}},
+		{in: "exec=exec.html", err: true},
+		{in: "/exec=", err: true},
+		{in: "/exec", err: true},
+		{in: "/docs/=docs.html", routes: map[string]string{"/docs": "docs.html"}},
+		{in: "/new/=new.html", routes: map[string]string{"/new": "new.html"}},
+		// served by the index already
+		{in: "/metrics=metrics.html", err: true},
+		{in: "/api/ingresses=api.html", err: true},
+		{in: "/healthz/=healthz.html", err: true},
+		{in: "/go=go.html", err: true},
+		{in: "/go/grafana=grafana.html", err: true},
+		// the same path twice
+		{in: "/exec=a.html,/exec=b.html", err: true},
+		{in: "/exec=a.html,/exec/=b.html", err: true},
+	} {
+		routes, err := parseTemplateRoutes(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: got error %v", tc.in, err)
+			continue
+		}
+		if !tc.err && !reflect.DeepEqual(routes, tc.routes) {
+			t.Errorf("%q: got %v, expected %v", tc.in, routes, tc.routes)
+		}
+	}
+}
+
+func TestFooter(t *testing.T) {
+	footer := `<a href="https://wiki.example.com">Docs</a>`
+	file := writeTempFile(t, "footer.html", footer)
+
+	for _, tc := range []struct {
+		name    string
+		footer  string
+		trusted bool
+		want    string
+	}{
+		{name: "escaped", footer: footer, want: `&lt;a href=&#34;https://wiki.example.com&#34;&gt;Docs&lt;/a&gt;`},
+		{name: "trusted", footer: footer, trusted: true, want: footer},
+		{name: "escaped file", footer: "@" + file, want: `&lt;a href=&#34;https://wiki.example.com&#34;&gt;Docs&lt;/a&gt;`},
+		{name: "trusted file", footer: "@" + file, trusted: true, want: footer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagFooterHTML, tc.footer)
+			setFlag(t, flagFooterTrusted, tc.trusted)
+			_, srv := newTestServer(t)
+
+			for _, theme := range themeNames() {
+				_, body := get(t, srv, "/?theme="+theme)
+				if !strings.Contains(body, tc.want) {
+					t.Errorf("%s: footer %s is missing", theme, tc.want)
+				}
+				if !tc.trusted && strings.Contains(body, footer) {
+					t.Errorf("%s: footer isn't escaped", theme)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderLoop(t *testing.T) {
+	const interval = 300 * time.Millisecond
+
+	respChan := make(chan []ingress)
+	doneChan := make(chan error)
+	rendered := make(chan int, 10)
+	go renderLoop(respChan, doneChan, interval, func(ings []ingress) { rendered <- len(ings) })
+	defer func() { doneChan <- errors.New("done") }()
+
+	// next returns the size of the next rendered snapshot and how long it
+	// took to arrive.
+	next := func() (int, time.Duration) {
+		t.Helper()
+		start := time.Now()
+		select {
+		case n := <-rendered:
+			return n, time.Since(start)
+		case <-time.After(5 * interval):
+			t.Fatal("nothing was rendered")
+			return 0, 0
+		}
+	}
+
+	// idle, the first change is rendered immediately
+	respChan <- make([]ingress, 1)
+	if n, took := next(); n != 1 || took >= interval {
+		t.Fatalf("got snapshot %d after %s, expected 1 immediately", n, took)
+	}
+
+	// a burst within the interval is rendered once, with the latest
+	for n := 2; n <= 4; n++ {
+		respChan <- make([]ingress, n)
+	}
+	if n, _ := next(); n != 4 {
+		t.Errorf("got snapshot %d, expected only the latest, 4", n)
+	}
+	select {
+	case n := <-rendered:
+		t.Errorf("got snapshot %d rendered after the coalesced one", n)
+	case <-time.After(2 * interval):
+	}
+
+	// idle again, rendered immediately
+	respChan <- make([]ingress, 5)
+	if n, took := next(); n != 5 || took >= interval {
+		t.Errorf("got snapshot %d after %s, expected 5 immediately", n, took)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	setFlag(t, flagBasePath, "index/")
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+
+	res, body := get(t, srv, "/index/")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", res.StatusCode)
+	}
+	for _, want := range []string{
+		`href="/index/new"`,
+		`href="/index/export.csv"`,
+		`href="http://example.com/index/favicon.svg"`,
+		`href="http://grafana.example.com"`, // external links are left alone
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page is missing %s", want)
+		}
+	}
+	if strings.Contains(body, "/index/http") || strings.Contains(body, `href="/new"`) {
+		t.Error("page has links without the prefix or external links with it")
+	}
+
+	for _, tc := range []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{path: "/index", code: http.StatusMovedPermanently, location: "/index/"},
+		{path: "/index/new", code: http.StatusOK},
+		{path: "/index/api/ingresses", code: http.StatusOK},
+		{path: "/new", code: http.StatusNotFound},
+	} {
+		res, _ := get(t, srv, tc.path)
+		if res.StatusCode != tc.code || res.Header.Get("Location") != tc.location {
+			t.Errorf("%s: got %d to %q, expected %d to %q", tc.path, res.StatusCode, res.Header.Get("Location"), tc.code, tc.location)
+		}
+	}
+}
+
+func TestCleanBasePath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":        "",
+		"/":       "",
+		"index":   "/index",
+		"/index/": "/index",
+		"/a/b/":   "/a/b",
+	} {
+		if got := cleanBasePath(in); got != want {
+			t.Errorf("cleanBasePath(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
+
+func TestTrailingSlashRedirects(t *testing.T) {
+	for _, tc := range []struct {
+		basePath string
+		path     string
+		location string
+	}{
+		{path: "/new/", location: "http://example.com/new"},
+		{path: "/new/?since=1h", location: "http://example.com/new?since=1h"},
+		{path: "/export.csv/", location: "http://example.com/export.csv"},
+		{path: "/export.jsonl/", location: "http://example.com/export.jsonl"},
+		{path: "/api/ingresses/", location: "http://example.com/api/ingresses"},
+		{path: "/api/summary/", location: "http://example.com/api/summary"},
+		{path: "/api/namespaces/", location: "http://example.com/api/namespaces"},
+		{path: "/healthz/", location: "http://example.com/healthz"},
+		{path: "/readyz/", location: "http://example.com/readyz"},
+		{path: "/go", location: "/go/"},
+		{basePath: "/index", path: "/index/new/", location: "http://example.com/index/new"},
+		{basePath: "/index", path: "/index/api/ingresses/?namespace=apps", location: "http://example.com/index/api/ingresses?namespace=apps"},
+	} {
+		setFlag(t, flagBasePath, tc.basePath)
+		_, srv := newTestServer(t)
+
+		res, _ := get(t, srv, tc.path)
+		if res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != tc.location {
+			t.Errorf("%s: got %d to %q, expected a redirect to %q", tc.path, res.StatusCode, res.Header.Get("Location"), tc.location)
+		}
+	}
+
+	// only the exact trailing slash form redirects
+	_, srv := newTestServer(t)
+	if res, _ := get(t, srv, "/new/other"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("/new/other: got %d, expected 404", res.StatusCode)
+	}
+}
+
+func TestDescriptions(t *testing.T) {
+	description := `Dashboards, see <a href="https://wiki.example.com">the wiki</a>`
+	ing := testIngress("apps", "grafana", "grafana.example.com")
+	ing.Annotations = map[string]string{annotationDescription: description}
+
+	for _, tc := range []struct {
+		name    string
+		trusted bool
+		want    string
+	}{
+		{name: "escaped", want: `Dashboards, see &lt;a href=&#34;https://wiki.example.com&#34;&gt;the wiki&lt;/a&gt;`},
+		{name: "trusted", trusted: true, want: description},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagTrustedDescriptions, tc.trusted)
+			_, srv := newTestServer(t, testEntries(t, ing)...)
+
+			for _, theme := range []string{"default", "grouped"} {
+				_, body := get(t, srv, "/?theme="+theme)
+				if !strings.Contains(body, tc.want) {
+					t.Errorf("%s: description %s is missing", theme, tc.want)
+				}
+				if !tc.trusted && strings.Contains(body, `<a href="https://wiki.example.com">`) {
+					t.Errorf("%s: description isn't escaped", theme)
+				}
+			}
+		})
+	}
+}
+
+func TestNoFollow(t *testing.T) {
+	flagged := testIngress("apps", "partner", "partner.example.com")
+	flagged.Annotations = map[string]string{annotationNoFollow: "true"}
+	flagged.Spec.Rules[0].HTTP = &k8sNetworking.HTTPIngressRuleValue{
+		Paths: []k8sNetworking.HTTPIngressPath{{Path: "/"}},
+	}
+	off := testIngress("apps", "docs", "docs.example.com")
+	off.Annotations = map[string]string{annotationNoFollow: "false"}
+	plain := testIngress("apps", "grafana", "grafana.example.com")
+
+	var ings []ingress
+	for _, ing := range []*k8sNetworking.Ingress{flagged, off, plain} {
+		ings = append(ings, testEntries(t, ing)...)
+	}
+	_, srv := newTestServer(t, ings...)
+
+	for _, theme := range themeNames() {
+		_, body := get(t, srv, "/?theme="+theme)
+		if n := strings.Count(body, `rel="nofollow"`); n != 1 {
+			t.Errorf("%s: got %d nofollow links, expected 1", theme, n)
+		}
+		if !strings.Contains(body, `rel="nofollow" href="http://partner.example.com`) {
+			t.Errorf("%s: the annotated entry isn't nofollow", theme)
+		}
+	}
+}
+
+func TestSecondaryLinks(t *testing.T) {
+	ing := testIngress("apps", "grafana", "grafana.example.com")
+	ing.Annotations = map[string]string{
+		annotationLinkPrefix + "docs":    "https://wiki.example.com/grafana",
+		annotationLinkPrefix + "runbook": "https://runbooks.example.com/grafana?page=1",
+		annotationLinkPrefix + "bad":     "javascript:alert(1)",
+		annotationLinkPrefix + "":        "https://empty.example.com",
+		annotationLinkPrefix + "path":    "/relative",
+	}
+	var entries []ingress
+	captureOutput(t, func() { entries = testEntries(t, ing) })
+
+	want := map[string]string{
+		"docs":    "https://wiki.example.com/grafana",
+		"runbook": "https://runbooks.example.com/grafana?page=1",
+	}
+	if !reflect.DeepEqual(entries[0].Links, want) {
+		t.Errorf("got links %v, expected %v", entries[0].Links, want)
+	}
+
+	_, srv := newTestServer(t, entries...)
+	for _, theme := range []string{"default", "grouped", "dense"} {
+		_, body := get(t, srv, "/?theme="+theme)
+		for _, link := range []string{`href="https://wiki.example.com/grafana">docs</a>`, `href="https://runbooks.example.com/grafana?page=1">runbook</a>`} {
+			if !strings.Contains(body, link) {
+				t.Errorf("%s: page is missing %s", theme, link)
+			}
+		}
+		if strings.Contains(body, "javascript:") || strings.Contains(body, "/relative") {
+			t.Errorf("%s: page contains an invalid link", theme)
+		}
+	}
+}
+
+func TestStylesheet(t *testing.T) {
+	embedded, err := webFS.ReadFile("web/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := writeTempFile(t, "custom.css", "body { color: rebeccapurple; }")
+
+	for _, tc := range []struct {
+		name       string
+		stylesheet string
+		want       string
+		unwanted   string
+	}{
+		{name: "default", want: string(embedded)},
+		{name: "custom", stylesheet: custom, want: "body { color: rebeccapurple; }", unwanted: string(embedded)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, flagStylesheet, tc.stylesheet)
+			_, srv := newTestServer(t)
+
+			// the dense theme has compact styles of its own
+			for _, theme := range []string{"default", "grouped", "hosts"} {
+				_, body := get(t, srv, "/?theme="+theme)
+				if !strings.Contains(body, "<style>"+tc.want+"</style>") {
+					t.Errorf("%s: the style block is missing", theme)
+				}
+				if tc.unwanted != "" && strings.Contains(body, tc.unwanted) {
+					t.Errorf("%s: the default styles are rendered alongside -stylesheet", theme)
+				}
+			}
+		})
+	}
+}
+
+func TestRuleAndPathCounts(t *testing.T) {
+	paths := func(paths ...string) *k8sNetworking.HTTPIngressRuleValue {
+		v := &k8sNetworking.HTTPIngressRuleValue{}
+		for _, p := range paths {
+			v.Paths = append(v.Paths, k8sNetworking.HTTPIngressPath{Path: p})
+		}
+		return v
+	}
+	ing := testIngress("apps", "shop", "shop.example.com", "api.example.com", "admin.example.com")
+	ing.Spec.Rules[0].HTTP = paths("/", "/cart", "/checkout")
+	ing.Spec.Rules[1].HTTP = paths("/v1", "/v2")
+	// the third rule has no paths
+
+	entries := testEntries(t, ing)
+	if entries[0].Rules != 3 || entries[0].Paths != 5 {
+		t.Errorf("got %d rules and %d paths, expected 3 and 5", entries[0].Rules, entries[0].Paths)
+	}
+
+	_, srv := newTestServer(t, entries...)
+	for _, theme := range []string{"default", "grouped"} {
+		if _, body := get(t, srv, "/?theme="+theme); !strings.Contains(body, `title="rules / paths">3/5</span>`) {
+			t.Errorf("%s: the counts are missing", theme)
+		}
+	}
+}
+
+func TestEmptyState(t *testing.T) {
+	setFlag(t, flagEmptyMessage, "Nothing here yet, ask #platform for access")
+	setFlag(t, flagEmptyLink, "https://wiki.example.com/access")
+
+	_, empty := newTestServer(t)
+	_, full := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	for _, theme := range themeNames() {
+		_, body := get(t, empty, "/?theme="+theme)
+		want := `Nothing here yet, ask #platform for access <a href="https://wiki.example.com/access">https://wiki.example.com/access</a>`
+		if !strings.Contains(body, want) {
+			t.Errorf("%s: the empty state is missing", theme)
+		}
+		if _, body := get(t, full, "/?theme="+theme); strings.Contains(body, "Nothing here yet") {
+			t.Errorf("%s: the empty state is shown alongside Ingresses", theme)
+		}
+	}
+}
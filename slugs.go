@@ -0,0 +1,117 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// ingressSlug returns the short link name of ing from the slug annotation,
+// lowercased. Slugs which aren't a single path segment are ignored with a
+// warning.
+func ingressSlug(ing *k8sNetworking.Ingress, logf printf) string {
+	slug := strings.ToLower(strings.TrimSpace(ing.Annotations[annotationSlug]))
+	if slug == "" {
+		return ""
+	}
+	if !validSlug(slug) {
+		logf("WARNING: ignoring %s annotation on %s/%s, %q isn't made of letters, digits, '-', '_' and '.'\n", annotationSlug, ing.Namespace, ing.Name, slug)
+		return ""
+	}
+	return slug
+}
+
+// validSlug reports if slug can be used as /go/<slug> as is.
+func validSlug(slug string) bool {
+	if slug == "." || slug == ".." {
+		return false
+	}
+	return strings.IndexFunc(slug, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) < 0
+}
+
+// slugTargets maps the slug of each entry in ings to its link. When several
+// Ingresses claim a slug the first by namespace/name wins, and every claim of
+// the slug is returned in collisions, winner first. An Ingress with several
+// entries is linked to by its first.
+func slugTargets(ings []ingress) (targets map[string]string, collisions map[string][]string) {
+	claims := make(map[string][]string)
+	for i := range ings {
+		slug, key := ings[i].Slug, ings[i].objectKey()
+		if slug != "" && !containsString(claims[slug], key) {
+			claims[slug] = append(claims[slug], key)
+		}
+	}
+
+	targets = make(map[string]string)
+	collisions = make(map[string][]string)
+	for slug, keys := range claims {
+		sort.Strings(keys)
+		if len(keys) > 1 {
+			collisions[slug] = keys
+		}
+	}
+	for i := range ings {
+		slug := ings[i].Slug
+		if slug == "" || ings[i].objectKey() != claims[slug][0] {
+			continue
+		}
+		if _, ok := targets[slug]; !ok {
+			targets[slug] = ings[i].Href()
+		}
+	}
+	return targets, collisions
+}
+
+// warnSlugCollisions logs a warning for each slug of collisions whose claims
+// differ from those in previous, so each collision is only reported once.
+func warnSlugCollisions(previous, collisions map[string][]string) {
+	for slug, keys := range collisions {
+		if strings.Join(previous[slug], ",") == strings.Join(keys, ",") {
+			continue
+		}
+		fmt.Printf("WARNING: slug %q is claimed by %s, /go/%s redirects to %s\n", slug, strings.Join(keys, ", "), slug, keys[0])
+	}
+}
+
+// serveSlug redirects /go/<slug> to the link of the entry with that slug.
+// Slugs are looked up with lookup, unless sites filters the Host of the
+// request, then among the current Ingresses it shows.
+func serveSlug(sites *hostFilters, lookup func(slug string) (string, bool), current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/go/"))
+		var (
+			target string
+			ok     bool
+		)
+		if filter := sites.forRequest(r); filter != nil {
+			targets, _ := slugTargets(filter.apply(current()))
+			target, ok = targets[slug]
+		} else {
+			target, ok = lookup(slug)
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
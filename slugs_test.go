@@ -0,0 +1,151 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	k8sNetworking "k8s.io/api/networking/v1"
+)
+
+// slugIngress returns an Ingress namespace/name for host claiming slug.
+func slugIngress(namespace, name, host, slug string) *k8sNetworking.Ingress {
+	ing := testIngress(namespace, name, host)
+	ing.Annotations = map[string]string{annotationSlug: slug}
+	return ing
+}
+
+func TestSlugRedirect(t *testing.T) {
+	var ings []ingress
+	captureOutput(t, func() {
+		for _, ing := range []*k8sNetworking.Ingress{
+			slugIngress("apps", "grafana", "grafana.example.com", "grafana"),
+			slugIngress("apps", "kibana", "kibana.example.com", " Logs "),
+			slugIngress("apps", "loki", "loki.example.com", "../loki"), // ignored
+			testIngress("apps", "tempo", "tempo.example.com"),
+		} {
+			ings = append(ings, testEntries(t, ing)...)
+		}
+	})
+	_, srv := newTestServer(t, ings...)
+
+	for _, tc := range []struct {
+		path     string
+		location string // empty for 404
+	}{
+		{path: "/go/grafana", location: "http://grafana.example.com"},
+		{path: "/go/Grafana", location: "http://grafana.example.com"},
+		{path: "/go/logs", location: "http://kibana.example.com"},
+		{path: "/go/unknown"},
+		{path: "/go/tempo"},
+		{path: "/go/loki"},
+		{path: "/go/"},
+	} {
+		res, _ := get(t, srv, tc.path)
+		if tc.location == "" {
+			if res.StatusCode != 404 {
+				t.Errorf("%s: got %d, expected 404", tc.path, res.StatusCode)
+			}
+			continue
+		}
+		if res.StatusCode != 302 || res.Header.Get("Location") != tc.location {
+			t.Errorf("%s: got %d to %q, expected 302 to %s", tc.path, res.StatusCode, res.Header.Get("Location"), tc.location)
+		}
+	}
+}
+
+func TestValidSlug(t *testing.T) {
+	for slug, valid := range map[string]bool{
+		"grafana":    true,
+		"team-a.ui":  true,
+		"a_b":        true,
+		".":          false,
+		"..":         false,
+		"a/b":        false,
+		"with space": false,
+		"ünïcode":    false,
+		"?q=1":       false,
+	} {
+		if got := validSlug(slug); got != valid {
+			t.Errorf("%q: got %v, expected %v", slug, got, valid)
+		}
+	}
+	if out := captureOutput(t, func() { ingressSlug(slugIngress("apps", "web", "web.example.com", "a/b"), fmt.Printf) }); !strings.Contains(out, "WARNING: ignoring "+annotationSlug) {
+		t.Errorf("an invalid slug wasn't logged, got %q", out)
+	}
+}
+
+func TestSlugCollision(t *testing.T) {
+	watchTestNamespace(t, "apps")
+	watchTestNamespace(t, "ops")
+	claims := []*k8sNetworking.Ingress{
+		slugIngress("ops", "grafana", "grafana.ops.example.com", "grafana"),
+		slugIngress("apps", "grafana-v2", "grafana-v2.example.com", "grafana"),
+		slugIngress("apps", "grafana", "grafana.example.com", "Grafana"),
+	}
+
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 0, 2}} {
+		respChan := make(chan []ingress, 10)
+		handler := ingressEventHandler(&ingresses{}, respChan)
+		captureOutput(t, func() {
+			for _, i := range order {
+				handler.AddFunc(claims[i])
+			}
+		})
+
+		var srv *server
+		out := captureOutput(t, func() { _, srv = newTestServer(t, latestSnapshot(respChan)...) })
+		want := `WARNING: slug "grafana" is claimed by apps/grafana, apps/grafana-v2, ops/grafana, /go/grafana redirects to apps/grafana`
+		if strings.Count(out, want) != 1 {
+			t.Errorf("order %v: logged %q, expected one warning", order, out)
+		}
+
+		res, _ := get(t, srv, "/go/grafana")
+		if location := res.Header.Get("Location"); location != "http://grafana.example.com" {
+			t.Errorf("order %v: /go/grafana redirects to %q, expected the apps/grafana Ingress", order, location)
+		}
+
+		_, body := get(t, srv, "/debug/conflicts")
+		var conflicts []conflict
+		if err := json.Unmarshal([]byte(body), &conflicts); err != nil {
+			t.Fatal(err)
+		}
+		expected := []conflict{{
+			Slug:      "grafana",
+			Ingresses: []string{"apps/grafana", "apps/grafana-v2", "ops/grafana"},
+			Winner:    "apps/grafana",
+		}}
+		if !reflect.DeepEqual(conflicts, expected) {
+			t.Errorf("order %v: /debug/conflicts got %+v, expected %+v", order, conflicts, expected)
+		}
+	}
+
+	// a collision which hasn't changed isn't reported again
+	idx := newIndex()
+	var ings []ingress
+	captureOutput(t, func() {
+		for _, ing := range claims {
+			ings = append(ings, testEntries(t, ing)...)
+		}
+	})
+	captureOutput(t, func() { idx.set(ings) })
+	if out := captureOutput(t, func() { idx.set(ings) }); out != "" {
+		t.Errorf("the same collision was logged again, %q", out)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	k8sCore "k8s.io/api/core/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Where an entry came from
+const (
+	sourceIngress   = "ingress"
+	sourceConfigMap = "configmap"
+)
+
+// staticEntries builds an entry for each link in cm, whose keys name the links
+// and values are their URLs. Values which aren't http(s) URLs are skipped.
+func staticEntries(cm *k8sCore.ConfigMap) []ingress {
+	names := make([]string, 0, len(cm.Data))
+	for name := range cm.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []ingress
+	for _, name := range names {
+		value := strings.TrimSpace(cm.Data[name])
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Printf("WARNING: ignoring invalid static link %s=%q in ConfigMap %s/%s\n", name, value, cm.Namespace, cm.Name)
+			continue
+		}
+		entry := ingress{
+			Namespace: cm.Namespace,
+			Name:      name,
+			FQDN:      u.String(),
+			TLS:       u.Scheme == "https",
+			Created:   cm.CreationTimestamp.Time,
+			UpdatedAt: lastUpdated(cm.ObjectMeta),
+			Source:    sourceConfigMap,
+		}
+		entry.ID = entryID(entry)
+		out = append(out, entry)
+	}
+	return out
+}
+
+// watchStaticLinks keeps the static links from the ConfigMap named by ref,
+// as namespace/name, in accum.
+func watchStaticLinks(kubeClient kubernetes.Interface, ref string, accum *ingresses, respChan chan []ingress) {
+	ns, name, _ := strings.Cut(ref, "/")
+	update := func(obj interface{}) {
+		if cm, ok := obj.(*k8sCore.ConfigMap); ok {
+			entries := staticEntries(cm)
+			sendSnapshot(respChan, accum.replaceStatic(entries))
+			fmt.Printf("loaded %d static links from ConfigMap %s\n", len(entries), ref)
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: update,
+		UpdateFunc: func(_, cur interface{}) {
+			update(cur)
+		},
+		DeleteFunc: func(interface{}) {
+			sendSnapshot(respChan, accum.replaceStatic(nil))
+			fmt.Printf("ConfigMap %s was deleted, removed its static links\n", ref)
+		},
+	}
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	watch := &cache.ListWatch{
+		ListFunc: func(opts k8sMeta.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return kubeClient.CoreV1().ConfigMaps(ns).List(ctx, opts)
+		},
+		WatchFunc: func(opts k8sMeta.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return kubeClient.CoreV1().ConfigMaps(ns).Watch(ctx, opts)
+		},
+	}
+	_, controller := cache.NewInformer(watch, &k8sCore.ConfigMap{}, *flagResyncInterval, handler)
+	go controller.Run(nil)
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// summary counts entries by how they're linked.
+type summary struct {
+	Total int `json:"total"`
+
+	// HTTPS entries link over https to a host with a TLS entry
+	HTTPS int `json:"https"`
+
+	// ForcedHTTPS entries link over https to a host without a TLS entry,
+	// because of -tls-mode=force or an ssl-redirect annotation
+	ForcedHTTPS int `json:"forcedHttps"`
+
+	// HTTP entries link over plain http
+	HTTP int `json:"http"`
+}
+
+func summarize(ings []ingress) summary {
+	var out summary
+	for i := range ings {
+		out.Total++
+		switch {
+		case !strings.HasPrefix(ings[i].FQDN, "https://"):
+			out.HTTP++
+		case ings[i].TLS:
+			out.HTTPS++
+		default:
+			out.ForcedHTTPS++
+		}
+	}
+	return out
+}
+
+// serveSummary responds with the summary of the current Ingresses, after any
+// filters given in the query, as JSON.
+func serveSummary(sites *hostFilters, current func() []ingress) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ings, err := filterRequest(sites, r, current())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("400 bad request: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summarize(ings))
+	}
+}
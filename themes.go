@@ -0,0 +1,190 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultTheme = "default"
+
+// themes maps each theme name to its embedded page template. Every theme is
+// rendered with the same pageData.
+var themes = map[string]string{
+	defaultTheme: "web/index.html",
+	"dense":      "web/dense.html",
+	"grouped":    "web/grouped.html",
+	"hosts":      "web/hosts.html",
+}
+
+// loadTheme parses the embedded template of the named theme.
+func loadTheme(name string) (*template.Template, error) {
+	file, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(themeNames(), ", "))
+	}
+	tpl, err := template.New(path.Base(file)).ParseFS(webFS, file)
+	if err != nil || *flagItemTemplate == "" {
+		return tpl, err
+	}
+	return withItemTemplate(tpl, *flagItemTemplate)
+}
+
+func themeNames() []string {
+	var out []string
+	for name := range themes {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// pageTemplates picks which template a page is rendered with.
+type pageTemplates struct {
+	byTheme      map[string]*template.Template
+	defaultTheme string
+	cookiePath   string
+
+	// files are the templates read from disk by theme, which are reloaded
+	files map[string]string
+	mu    sync.RWMutex
+}
+
+// singleTemplate returns pageTemplates which always pick tpl, read from the
+// file at path.
+func singleTemplate(path string, tpl *template.Template) *pageTemplates {
+	return &pageTemplates{
+		byTheme: map[string]*template.Template{"": tpl},
+		files:   map[string]string{"": path},
+	}
+}
+
+// loadThemes parses every embedded theme. When override is set that template
+// file replaces the default theme.
+func loadThemes(defaultName, override, basePath string) (*pageTemplates, error) {
+	if _, ok := themes[defaultName]; !ok {
+		return nil, fmt.Errorf("unknown -default-theme %q, expected one of %s", defaultName, strings.Join(themeNames(), ", "))
+	}
+	out := &pageTemplates{
+		byTheme:      make(map[string]*template.Template),
+		defaultTheme: defaultName,
+		cookiePath:   basePath + "/",
+		files:        make(map[string]string),
+	}
+	for name := range themes {
+		tpl, err := loadTheme(name)
+		if err != nil {
+			return nil, err
+		}
+		out.byTheme[name] = tpl
+	}
+	if override != "" {
+		tpl, err := loadTemplate(override)
+		if err != nil {
+			return nil, err
+		}
+		out.byTheme[defaultTheme] = tpl
+		out.files[defaultTheme] = override
+	}
+	return out, nil
+}
+
+// get returns the template of the named theme.
+func (p *pageTemplates) get(name string) (*template.Template, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	tpl, ok := p.byTheme[name]
+	return tpl, ok
+}
+
+// pick returns the template of the theme named by the ?theme= query parameter,
+// remembering the choice in a cookie, or by an earlier choice's cookie. Unknown
+// themes fall back to the default.
+func (p *pageTemplates) pick(w http.ResponseWriter, r *http.Request) *template.Template {
+	if name := r.URL.Query().Get("theme"); name != "" {
+		if tpl, ok := p.get(name); ok {
+			http.SetCookie(w, &http.Cookie{
+				Name:     "theme",
+				Value:    name,
+				Path:     p.cookiePath,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			return tpl
+		}
+	}
+	if c, err := r.Cookie("theme"); err == nil {
+		if tpl, ok := p.get(c.Value); ok {
+			return tpl
+		}
+	}
+	tpl, _ := p.get(p.defaultTheme)
+	return tpl
+}
+
+// reload reads the templates from disk again. A template which can't be
+// read, or fails loadTemplate's checks, keeps the one in use so pages are
+// still served.
+func (p *pageTemplates) reload() {
+	for name, path := range p.files {
+		tpl, err := loadTemplate(path)
+		if err != nil {
+			fmt.Printf("ERROR: reloading template %s, keeping the previous one, err=%v\n", path, err)
+			continue
+		}
+		p.mu.Lock()
+		p.byTheme[name] = tpl
+		p.mu.Unlock()
+		fmt.Printf("reloaded template %s\n", path)
+	}
+}
+
+// templateSets are every pageTemplates of a server read from disk.
+type templateSets struct {
+	sets []*pageTemplates
+	mu   sync.Mutex
+}
+
+func (t *templateSets) add(p *pageTemplates) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sets = append(t.sets, p)
+}
+
+func (t *templateSets) reload() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range t.sets {
+		p.reload()
+	}
+}
+
+// reloadOnSignal reloads the templates each time a signal arrives on
+// signalChan.
+func reloadOnSignal(signalChan chan os.Signal, t *templateSets) {
+	for range signalChan {
+		t.reload()
+	}
+}
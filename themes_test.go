@@ -0,0 +1,61 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReloadBrokenTemplate(t *testing.T) {
+	path := writeTempFile(t, "index.html", "v1 {{len .Ingresses}}")
+	setFlag(t, flagTemplate, path)
+	_, srv := newTestServer(t, testEntries(t, testIngress("apps", "grafana", "grafana.example.com"))...)
+	if _, body := get(t, srv, "/"); body != "v1 1" {
+		t.Fatalf("got %q before reloading", body)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content string // the file is removed when empty
+		body    string
+		logged  string
+	}{
+		{name: "parse error", content: "v2 {{len .Ingresses", body: "v1 1", logged: "ERROR: reloading template"},
+		{name: "unknown field", content: "v2 {{ .Title }}", body: "v1 1", logged: "can't evaluate field Title"},
+		{name: "removed", body: "v1 1", logged: "no such file or directory"},
+		{name: "fixed", content: "v2 {{len .Ingresses}}", body: "v2 1", logged: "reloaded template " + path},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.content == "" {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			out := captureOutput(t, srv.templates.reload)
+			if !strings.Contains(out, tc.logged) {
+				t.Errorf("logged %q, expected %q", out, tc.logged)
+			}
+			res, body := get(t, srv, "/")
+			if res.StatusCode != 200 || body != tc.body {
+				t.Errorf("got %d %q, expected %q", res.StatusCode, body, tc.body)
+			}
+		})
+	}
+}
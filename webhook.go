@@ -0,0 +1,184 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// how many deliveries can be waiting, the oldest is dropped beyond it
+	webhookQueueSize = 16
+
+	// attempts at each delivery before it counts as failed
+	webhookAttempts  = 3
+	webhookRetryWait = time.Second
+
+	// consecutive failed deliveries which open the circuit, and how long it
+	// then stays open. The wait doubles each time it re-opens up to the max.
+	webhookFailureThreshold = 3
+	webhookBreakerWait      = 10 * time.Second
+	webhookBreakerMaxWait   = 5 * time.Minute
+
+	webhookDeliveries = newCounter("kube_ingress_index_webhook_deliveries_total", "Changes delivered to -webhook-url.")
+	webhookFailures   = newCounter("kube_ingress_index_webhook_failures_total", "Changes which couldn't be delivered to -webhook-url after retrying.")
+	webhookDrops      = newCounter("kube_ingress_index_webhook_drops_total", "Changes dropped because the -webhook-url queue was full.")
+)
+
+// webhook POSTs the Ingresses to a URL each time they change. Deliveries are
+// queued and sent one at a time so a slow or failing endpoint never blocks
+// updating the index.
+type webhook struct {
+	url    string
+	client *http.Client
+	queue  chan []ingress
+
+	// circuit breaker state, only touched by the delivery goroutine
+	failures  int
+	openUntil time.Time
+	wait      time.Duration
+
+	mu sync.Mutex // serializes enqueue's drop-oldest
+}
+
+func newWebhook(url string, timeout time.Duration) *webhook {
+	return &webhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan []ingress, webhookQueueSize),
+	}
+}
+
+// watch queues a delivery for each snapshot published on b, until b closes.
+func (h *webhook) watch(b *broadcaster) {
+	updates := b.subscribe()
+	go h.run()
+	for ings := range updates {
+		h.enqueue(ings)
+	}
+	close(h.queue)
+}
+
+// enqueue adds ings to the queue without blocking, dropping the oldest
+// delivery when it's full.
+func (h *webhook) enqueue(ings []ingress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for {
+		select {
+		case h.queue <- ings:
+			return
+		default:
+		}
+		select {
+		case <-h.queue:
+			webhookDrops.inc()
+		default:
+		}
+	}
+}
+
+// run delivers queued snapshots until the queue is closed.
+func (h *webhook) run() {
+	for ings := range h.queue {
+		if wait := h.openUntil.Sub(now()); wait > 0 {
+			time.Sleep(wait)
+		}
+		if err := h.deliver(ings); err != nil {
+			webhookFailures.inc()
+			var rejected *webhookRejected
+			if errors.As(err, &rejected) {
+				// the endpoint is up, it won't take this delivery
+				fmt.Printf("ERROR: webhook %s rejected a delivery, err=%v\n", h.url, err)
+				continue
+			}
+			h.failed(err)
+			continue
+		}
+		webhookDeliveries.inc()
+		if h.failures >= webhookFailureThreshold {
+			fmt.Printf("webhook %s recovered, closing circuit\n", h.url)
+		}
+		h.failures, h.wait = 0, 0
+	}
+}
+
+// failed records a failed delivery, opening the circuit once enough have
+// failed in a row.
+func (h *webhook) failed(err error) {
+	h.failures++
+	if h.failures < webhookFailureThreshold {
+		return
+	}
+	if h.wait == 0 {
+		h.wait = webhookBreakerWait
+	} else if h.wait *= 2; h.wait > webhookBreakerMaxWait {
+		h.wait = webhookBreakerMaxWait
+	}
+	h.openUntil = now().Add(h.wait)
+	fmt.Printf("WARNING: webhook %s failed %d times in a row, pausing deliveries for %v, err=%v\n", h.url, h.failures, h.wait, err)
+}
+
+// webhookRejected is a response other than 2xx or 5xx, which retrying won't
+// change.
+type webhookRejected struct {
+	status string
+}
+
+func (e *webhookRejected) Error() string {
+	return "unexpected status " + e.status
+}
+
+// deliver POSTs ings as JSON, retrying errors and 5xx responses. A rejected
+// delivery is returned straight away.
+func (h *webhook) deliver(ings []ingress) error {
+	if ings == nil {
+		ings = []ingress{}
+	}
+	body, err := json.Marshal(ings)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = h.post(body)
+		var rejected *webhookRejected
+		if err == nil || errors.As(err, &rejected) || attempt >= webhookAttempts {
+			return err
+		}
+		time.Sleep(webhookRetryWait * time.Duration(attempt))
+	}
+}
+
+func (h *webhook) post(body []byte) error {
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return &webhookRejected{status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2018 Jack Henry and Associates
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookEndpoint answers each delivery with the next of statuses, repeating
+// the last, and records when they arrived.
+type webhookEndpoint struct {
+	statuses []int
+	arrived  []time.Time
+	mu       sync.Mutex
+}
+
+func (e *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := e.statuses[0]
+	if len(e.statuses) > 1 {
+		e.statuses = e.statuses[1:]
+	}
+	e.arrived = append(e.arrived, time.Now())
+	w.WriteHeader(status)
+}
+
+func (e *webhookEndpoint) answer(statuses ...int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.statuses = statuses
+}
+
+func (e *webhookEndpoint) take() []time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := e.arrived
+	e.arrived = nil
+	return out
+}
+
+// runQueued delivers ings through h, returning once they've all been tried.
+func runQueued(h *webhook, ings ...[]ingress) {
+	h.queue = make(chan []ingress, len(ings))
+	for _, snapshot := range ings {
+		h.queue <- snapshot
+	}
+	close(h.queue)
+	h.run()
+}
+
+func TestWebhookQueueDropsOldest(t *testing.T) {
+	setFlag(t, &webhookQueueSize, 2)
+	h := newWebhook("http://webhook.invalid", time.Second)
+
+	drops := atomic.LoadUint64(&webhookDrops.value)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		h.enqueue([]ingress{{Name: name}})
+	}
+	if n := atomic.LoadUint64(&webhookDrops.value) - drops; n != 3 {
+		t.Errorf("counted %d drops, expected 3", n)
+	}
+	close(h.queue)
+	var queued []string
+	for ings := range h.queue {
+		queued = append(queued, ings[0].Name)
+	}
+	if strings.Join(queued, ",") != "d,e" {
+		t.Errorf("got %v queued, expected the latest two", queued)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	setFlag(t, &webhookRetryWait, time.Millisecond)
+	endpoint := &webhookEndpoint{}
+	ts := httptest.NewServer(endpoint)
+	defer ts.Close()
+	h := newWebhook(ts.URL, time.Second)
+
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		attempts int
+		err      bool
+		rejected bool
+	}{
+		{name: "delivered", statuses: []int{200}, attempts: 1},
+		{name: "recovers", statuses: []int{503, 502, 204}, attempts: 3},
+		{name: "keeps failing", statuses: []int{500}, attempts: 3, err: true},
+		{name: "bad request", statuses: []int{400}, attempts: 1, err: true, rejected: true},
+		{name: "not found", statuses: []int{404}, attempts: 1, err: true, rejected: true},
+		{name: "fails then rejected", statuses: []int{503, 403}, attempts: 2, err: true, rejected: true},
+	} {
+		endpoint.answer(tc.statuses...)
+		err := h.deliver(nil)
+		if got := len(endpoint.take()); got != tc.attempts {
+			t.Errorf("%s: got %d attempts, expected %d", tc.name, got, tc.attempts)
+		}
+		var rejected *webhookRejected
+		if (err != nil) != tc.err || errors.As(err, &rejected) != tc.rejected {
+			t.Errorf("%s: got error %v, expected error=%v rejected=%v", tc.name, err, tc.err, tc.rejected)
+		}
+	}
+
+	// connection errors are retried too
+	down := newWebhook("http://127.0.0.1:1", time.Second)
+	var rejected *webhookRejected
+	if err := down.deliver(nil); err == nil || errors.As(err, &rejected) {
+		t.Errorf("got %v from an endpoint which is down", err)
+	}
+}
+
+func TestWebhookBreaker(t *testing.T) {
+	setFlag(t, &webhookAttempts, 1)
+	setFlag(t, &webhookFailureThreshold, 2)
+	setFlag(t, &webhookBreakerWait, 20*time.Millisecond)
+	setFlag(t, &webhookBreakerMaxWait, 30*time.Millisecond)
+	endpoint := &webhookEndpoint{}
+	ts := httptest.NewServer(endpoint)
+	defer ts.Close()
+	h := newWebhook(ts.URL, time.Second)
+
+	// rejected deliveries never open the circuit
+	endpoint.answer(400)
+	captureOutput(t, func() { runQueued(h, nil, nil, nil) })
+	if h.failures != 0 || !h.openUntil.IsZero() {
+		t.Fatalf("rejected deliveries counted as failures, failures=%d", h.failures)
+	}
+
+	endpoint.answer(500)
+	out := captureOutput(t, func() { runQueued(h, nil, nil) })
+	if h.failures != 2 || h.wait != 20*time.Millisecond || !strings.Contains(out, "pausing deliveries for 20ms") {
+		t.Fatalf("after 2 failures got failures=%d wait=%v: %s", h.failures, h.wait, out)
+	}
+	endpoint.take()
+
+	// nothing is sent while it's open, and failing again doubles the wait
+	// up to the max
+	openUntil := h.openUntil
+	captureOutput(t, func() { runQueued(h, nil) })
+	if arrived := endpoint.take(); len(arrived) != 1 || arrived[0].Before(openUntil) {
+		t.Errorf("delivered at %v while open until %v", arrived, openUntil)
+	}
+	if h.wait != 30*time.Millisecond {
+		t.Errorf("got wait %v, expected the max of 30ms", h.wait)
+	}
+
+	endpoint.answer(200)
+	out = captureOutput(t, func() { runQueued(h, nil) })
+	if h.failures != 0 || h.wait != 0 || !strings.Contains(out, "recovered, closing circuit") {
+		t.Errorf("after a delivery got failures=%d wait=%v: %s", h.failures, h.wait, out)
+	}
+}